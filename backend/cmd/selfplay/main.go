@@ -0,0 +1,169 @@
+// Command selfplay estimates the rating of every numbered bot level by playing
+// seeded round robins between them and fitting Elo ratings to the results.
+// A single round robin moves each gap by 15 points or so depending on the
+// seed, so the ratings of several runs are averaged. The estimates are what
+// bot.Levels is calibrated against.
+//
+//	go run ./cmd/selfplay [-games 200] [-runs 16] [-size 3] [-win 3] [-seed 1]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"nakama-arena/modules/bot"
+	"nakama-arena/modules/game"
+)
+
+// anchorRating is the average rating the fitted ratings are centred on
+const anchorRating = 1500
+
+func main() {
+	games := flag.Int("games", 200, "games per pair of levels, alternating who moves first")
+	runs := flag.Int("runs", 16, "round robins to average, each seeded one higher than the last")
+	size := flag.Int("size", game.DefaultSize, "board size")
+	winLength := flag.Int("win", 0, "marks in a row needed to win, 0 for the size's default")
+	seed := flag.Int64("seed", 1, "rng seed of the first run")
+	budget := flag.Duration("budget", 50*time.Millisecond, "time budget per move")
+	flag.Parse()
+
+	if *winLength == 0 {
+		*winLength = game.DefaultWinLengthFor(*size)
+	}
+	if _, err := game.NewBoard(*size, *winLength); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid board: %v\n", err)
+		os.Exit(1)
+	}
+	if *runs < 1 {
+		fmt.Fprintln(os.Stderr, "runs must be at least 1")
+		os.Exit(1)
+	}
+
+	ratings := make([]float64, bot.MaxLevel)
+	scores := make([]float64, bot.MaxLevel)
+	gaps := make([]float64, bot.MaxLevel)
+	gapSquares := make([]float64, bot.MaxLevel)
+	for run := 0; run < *runs; run++ {
+		results := roundRobin(*seed+int64(run), *games, *size, *winLength, *budget)
+		fitted := fitRatings(results, float64(*games))
+		for i, rating := range fitted {
+			ratings[i] += rating / float64(*runs)
+			for _, s := range results[i] {
+				scores[i] += s
+			}
+			if i > 0 {
+				gap := rating - fitted[i-1]
+				gaps[i] += gap
+				gapSquares[i] += gap * gap
+			}
+		}
+	}
+
+	fmt.Printf("%dx%d, %d in a row, %d games per pair, %d runs\n\n", *size, *size, *winLength, *games, *runs)
+	fmt.Println("level  rating  gap  spread  score  noise  depth")
+	for i, rating := range ratings {
+		gap, spread := "", ""
+		if i > 0 {
+			gap = fmt.Sprintf("%+4.0f", rating-ratings[i-1])
+			mean := gaps[i] / float64(*runs)
+			spread = fmt.Sprintf("%4.0f", math.Sqrt(math.Max(gapSquares[i]/float64(*runs)-mean*mean, 0)))
+		}
+		config := bot.Levels[i]
+		fmt.Printf("%5d  %6.0f  %4s  %6s  %4.0f%%  %5.2f  %5d\n", i+1, rating, gap, spread,
+			100*scores[i]/float64(*games*(bot.MaxLevel-1)**runs), config.Noise, config.Depth)
+	}
+}
+
+// roundRobin plays games between every pair of levels and returns the scores,
+// where scores[i][j] is level i+1's points against level j+1, a draw being half
+func roundRobin(seed int64, games, size, winLength int, budget time.Duration) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	players := make([]bot.Strategy, bot.MaxLevel)
+	for i := range players {
+		players[i] = bot.NewLeveled(rand.New(rand.NewSource(rng.Int63())), bot.Levels[i])
+	}
+
+	scores := make([][]float64, bot.MaxLevel)
+	for i := range scores {
+		scores[i] = make([]float64, bot.MaxLevel)
+	}
+	for i := 0; i < bot.MaxLevel; i++ {
+		for j := i + 1; j < bot.MaxLevel; j++ {
+			for g := 0; g < games; g++ {
+				x, o := i, j
+				if g%2 == 1 {
+					x, o = j, i
+				}
+				switch play(players[x], players[o], size, winLength, budget) {
+				case game.XWins:
+					scores[x][o]++
+				case game.OWins:
+					scores[o][x]++
+				default:
+					scores[x][o] += 0.5
+					scores[o][x] += 0.5
+				}
+			}
+		}
+	}
+	return scores
+}
+
+// play runs one game and returns its outcome
+func play(x, o bot.Strategy, size, winLength int, budget time.Duration) game.Outcome {
+	board, _ := game.NewBoard(size, winLength)
+	players := map[game.Mark]bot.Strategy{game.X: x, game.O: o}
+	for mark := game.X; ; mark = mark.Opponent() {
+		move, err := players[mark].ChooseMove(board, mark, budget)
+		if err != nil {
+			return game.Draw
+		}
+		if err := board.Play(move, mark); err != nil {
+			// An illegal move forfeits the game
+			return game.WinFor(mark.Opponent())
+		}
+		if outcome := board.OutcomeAfter(move); outcome.Finished() {
+			return outcome
+		}
+	}
+}
+
+// fitRatings finds the Elo ratings that best explain the pairwise scores by
+// gradient ascent on the Bradley-Terry likelihood, centred on anchorRating
+func fitRatings(scores [][]float64, gamesPerPair float64) []float64 {
+	n := len(scores)
+	ratings := make([]float64, n)
+	for iter := 0; iter < 10000; iter++ {
+		maxStep := 0.0
+		for i := range ratings {
+			gradient := 0.0
+			for j := range ratings {
+				if i == j {
+					continue
+				}
+				expected := gamesPerPair / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+				gradient += scores[i][j] - expected
+			}
+			step := gradient / gamesPerPair * 10
+			ratings[i] += step
+			maxStep = math.Max(maxStep, math.Abs(step))
+		}
+		if maxStep < 1e-6 {
+			break
+		}
+	}
+
+	mean := 0.0
+	for _, r := range ratings {
+		mean += r
+	}
+	mean /= float64(n)
+	for i := range ratings {
+		ratings[i] += anchorRating - mean
+	}
+	return ratings
+}
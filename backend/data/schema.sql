@@ -6,7 +6,14 @@ CREATE TABLE IF NOT EXISTS player_stats (
   wins INT DEFAULT 0,
   losses INT DEFAULT 0,
   draws INT DEFAULT 0,
-  rank INT DEFAULT 0,
+  rank INT DEFAULT 0, -- unused; ranks come from the arena_rating leaderboard
+  rating DOUBLE PRECISION DEFAULT 1500, -- Glicko-2 rating on the Glicko scale
+  rating_deviation DOUBLE PRECISION DEFAULT 350,
+  rating_volatility DOUBLE PRECISION DEFAULT 0.06,
+  season_wins INT DEFAULT 0, -- record in the current season
+  season_losses INT DEFAULT 0,
+  season_draws INT DEFAULT 0,
+  leaderboards_backfilled BOOLEAN DEFAULT TRUE, -- NULL until copied onto the Nakama leaderboards
   created_at TIMESTAMPTZ DEFAULT NOW(),
   updated_at TIMESTAMPTZ DEFAULT NOW()
 );
@@ -14,15 +21,116 @@ CREATE TABLE IF NOT EXISTS player_stats (
 CREATE TABLE IF NOT EXISTS matches (
   id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
   player1_id UUID NOT NULL,
-  player2_id UUID NOT NULL,
+  player2_id UUID, -- NULL when player 1 played a bot
   winner_id UUID,
   is_draw BOOLEAN DEFAULT FALSE,
+  bot_id VARCHAR(32), -- strategy the bot played with
+  bot_difficulty VARCHAR(32),
+  bot_won BOOLEAN DEFAULT FALSE,
   game_state JSONB,
   created_at TIMESTAMPTZ DEFAULT NOW(),
   updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Upgrade matches tables created before bot games were recorded
+ALTER TABLE matches ALTER COLUMN player2_id DROP NOT NULL;
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bot_id VARCHAR(32);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bot_difficulty VARCHAR(32);
+ALTER TABLE matches ADD COLUMN IF NOT EXISTS bot_won BOOLEAN DEFAULT FALSE;
+
+-- Upgrade player_stats tables created before ratings replaced flat scores
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS rating DOUBLE PRECISION DEFAULT 1500;
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS rating_deviation DOUBLE PRECISION DEFAULT 350;
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS rating_volatility DOUBLE PRECISION DEFAULT 0.06;
+
+-- Upgrade player_stats tables created before seasons
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS season_wins INT DEFAULT 0;
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS season_losses INT DEFAULT 0;
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS season_draws INT DEFAULT 0;
+
+-- Upgrade player_stats tables created before the Nakama leaderboards; rows that
+-- existed then are left NULL and copied onto the leaderboards once on startup
+ALTER TABLE player_stats ADD COLUMN IF NOT EXISTS leaderboards_backfilled BOOLEAN;
+ALTER TABLE player_stats ALTER COLUMN leaderboards_backfilled SET DEFAULT TRUE;
+
+-- Competitive seasons; insert rows to schedule custom start and end dates,
+-- otherwise the server creates them back to back
+CREATE TABLE IF NOT EXISTS seasons (
+  id VARCHAR(32) PRIMARY KEY,
+  name VARCHAR(128) NOT NULL,
+  starts_at TIMESTAMPTZ NOT NULL,
+  ends_at TIMESTAMPTZ NOT NULL,
+  closed_at TIMESTAMPTZ, -- set once the standings are archived
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Final standings of each ended season
+CREATE TABLE IF NOT EXISTS season_standings (
+  season_id VARCHAR(32) NOT NULL REFERENCES seasons(id),
+  user_id UUID NOT NULL,
+  username VARCHAR(128) NOT NULL,
+  rank INT NOT NULL,
+  rating DOUBLE PRECISION NOT NULL,
+  rating_deviation DOUBLE PRECISION NOT NULL,
+  conservative_rating DOUBLE PRECISION NOT NULL,
+  wins INT NOT NULL,
+  losses INT NOT NULL,
+  draws INT NOT NULL,
+  PRIMARY KEY (season_id, user_id)
+);
+
+-- One row per rated player per match, for rating charts
+CREATE TABLE IF NOT EXISTS rating_history (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID NOT NULL,
+  match_id UUID NOT NULL,
+  opponent_id UUID NOT NULL,
+  result DOUBLE PRECISION NOT NULL, -- 1 win, 0.5 draw, 0 loss
+  rating_before DOUBLE PRECISION NOT NULL,
+  rating DOUBLE PRECISION NOT NULL,
+  rating_deviation DOUBLE PRECISION NOT NULL,
+  rating_volatility DOUBLE PRECISION NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Every change to player_stats or bot_stats and where it came from
+CREATE TABLE IF NOT EXISTS stat_audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  user_id UUID, -- NULL for changes to every player
+  source VARCHAR(32) NOT NULL, -- match, bot_match, season_reset or server
+  match_id UUID,
+  details JSONB,
+  created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Results against the bot, kept apart from the PvP stats and leaderboard
+CREATE TABLE IF NOT EXISTS bot_stats (
+  user_id UUID NOT NULL,
+  difficulty VARCHAR(32) NOT NULL,
+  wins INT DEFAULT 0,
+  losses INT DEFAULT 0,
+  draws INT DEFAULT 0,
+  created_at TIMESTAMPTZ DEFAULT NOW(),
+  updated_at TIMESTAMPTZ DEFAULT NOW(),
+  PRIMARY KEY (user_id, difficulty)
+);
+
+-- When each player started searching for their current matchmaker ticket,
+-- so the skill window widens on the server's clock
+CREATE TABLE IF NOT EXISTS matchmaking_queue (
+  user_id UUID PRIMARY KEY,
+  ticket VARCHAR(64) NOT NULL, -- mode and variant
+  queued_at TIMESTAMPTZ NOT NULL,
+  requeued_at TIMESTAMPTZ NOT NULL
+);
+
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS player_stats_score_idx ON player_stats(score DESC);
 CREATE INDEX IF NOT EXISTS matches_player1_idx ON matches(player1_id);
-CREATE INDEX IF NOT EXISTS matches_player2_idx ON matches(player2_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS matches_player2_idx ON matches(player2_id);
+CREATE INDEX IF NOT EXISTS matches_bot_difficulty_idx ON matches(bot_difficulty) WHERE bot_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS player_stats_conservative_rating_idx ON player_stats((rating - 2 * rating_deviation) DESC);
+CREATE INDEX IF NOT EXISTS rating_history_user_idx ON rating_history(user_id, created_at);
+CREATE INDEX IF NOT EXISTS season_standings_rank_idx ON season_standings(season_id, rank);
+CREATE INDEX IF NOT EXISTS seasons_open_idx ON seasons(starts_at) WHERE closed_at IS NULL;
+CREATE INDEX IF NOT EXISTS stat_audit_log_user_idx ON stat_audit_log(user_id, created_at);
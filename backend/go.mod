@@ -4,4 +4,4 @@ go 1.21
 
 require github.com/heroiclabs/nakama-common v1.31.0
 
-require google.golang.org/protobuf v1.31.0 // indirect
+require google.golang.org/protobuf v1.31.0
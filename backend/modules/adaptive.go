@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+
+	"nakama-arena/modules/bot"
+)
+
+const (
+	// AdaptiveDifficulty makes the bot track the player's skill between games
+	AdaptiveDifficulty = "adaptive"
+
+	// adaptiveNewPlayerLevel is where players without any history start
+	adaptiveNewPlayerLevel = 2
+
+	// Skill steps after each game. Draws count against the bot so that on
+	// draw-heavy boards it still drifts towards the player winning half the
+	// time.
+	adaptiveWinStep  = 1.0
+	adaptiveLossStep = -1.0
+	adaptiveDrawStep = -0.5
+)
+
+// adaptiveStartSkill guesses a starting level from a player's record: their
+// share of points maps linearly onto the level range
+func adaptiveStartSkill(wins, losses, draws int) float64 {
+	games := wins + losses + draws
+	if games == 0 {
+		return adaptiveNewPlayerLevel
+	}
+	share := (float64(wins) + 0.5*float64(draws)) / float64(games)
+	return float64(bot.MinLevel) + share*float64(bot.MaxLevel-bot.MinLevel)
+}
+
+// startAdaptiveBot sets the bot's opening level from the player's combined
+// history in player_stats and bot_stats
+func (m *TicTacToeMatch) startAdaptiveBot(ctx context.Context, s *TicTacToeState, userID string) {
+	var wins, losses, draws int
+	err := m.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(wins), 0), COALESCE(SUM(losses), 0), COALESCE(SUM(draws), 0)
+		FROM (
+			SELECT wins, losses, draws FROM player_stats WHERE user_id = $1
+			UNION ALL
+			SELECT wins, losses, draws FROM bot_stats WHERE user_id = $1
+		) history
+	`, userID).Scan(&wins, &losses, &draws)
+	if err != nil && err != sql.ErrNoRows {
+		m.logger.Warn("Error reading player stats for adaptive bot: %v", err)
+	}
+	s.BotSkill = adaptiveStartSkill(wins, losses, draws)
+	m.setBotLevel(s)
+}
+
+// adaptBot moves the bot's skill after a game towards an even win rate: up
+// when the player won, down when the bot won or the game was drawn
+func (m *TicTacToeMatch) adaptBot(s *TicTacToeState, winnerID string) {
+	switch winnerID {
+	case "":
+		s.BotSkill += adaptiveDrawStep
+	case "bot":
+		s.BotSkill += adaptiveLossStep
+	default:
+		s.BotSkill += adaptiveWinStep
+	}
+	s.BotSkill = math.Max(bot.MinLevel, math.Min(bot.MaxLevel, s.BotSkill))
+	m.setBotLevel(s)
+}
+
+// setBotLevel switches the bot to the numbered level nearest its skill
+func (m *TicTacToeMatch) setBotLevel(s *TicTacToeState) {
+	level := int(math.Round(s.BotSkill))
+	if level == s.BotLevel {
+		return
+	}
+	strategy, err := bot.New(bot.LevelName(level), m.rng)
+	if err != nil {
+		m.logger.Error("Error creating adaptive bot level %d: %v", level, err)
+		return
+	}
+	s.BotLevel = level
+	s.BotStrategy = bot.LevelName(level)
+	m.strategy = strategy
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// Sources of stat changes recorded in stat_audit_log
+const (
+	StatSourceMatch       = "match"        // PvP series
+	StatSourceBotMatch    = "bot_match"    // series against the bot
+	StatSourceSeasonReset = "season_reset" // soft reset when a season ends
+	StatSourceServer      = "server"       // correction via update_player_stats
+)
+
+// execer runs statements on a database or inside a transaction
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// auditStatChange records a stat mutation. Call it with the transaction that
+// made the change so the two commit together. userID is empty for changes to
+// every player and matchID is empty outside the match path.
+func auditStatChange(ctx context.Context, db execer, userID, source, matchID string, details map[string]interface{}) error {
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO stat_audit_log (user_id, source, match_id, details)
+		VALUES (NULLIF($1, '')::UUID, $2, NULLIF($3, '')::UUID, $4)
+	`, userID, source, matchID, detailsJSON)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/game"
+)
+
+// BotMoveBudget bounds how long a bot strategy may think inside the match loop
+const BotMoveBudget = 200 * time.Millisecond
+
+// Sides a player can ask for with the player_mark param of a bot match
+const (
+	PlayerMarkX      = "x"
+	PlayerMarkO      = "o"
+	PlayerMarkRandom = "random"
+)
+
+// botDelay is the range of simulated thinking time before a bot moves
+type botDelay struct {
+	MinMs int `json:"min_ms"`
+	MaxMs int `json:"max_ms"`
+}
+
+// botDelays holds the default thinking time for each difficulty; matches can
+// override it with the bot_delay_min_ms and bot_delay_max_ms params
+var botDelays = map[string]botDelay{
+	"easy":   {MinMs: 500, MaxMs: 1500},
+	"medium": {MinMs: 800, MaxMs: 2000},
+	"hard":   {MinMs: 1000, MaxMs: 3000},
+}
+
+// botOnTurn reports whether the bot has to move next
+func (s *TicTacToeState) botOnTurn() bool {
+	if !s.BotMatch || s.MatchState != MatchStateInProgress {
+		return false
+	}
+	mark, ok := s.Players["bot"]
+	return ok && mark == s.CurrentTurn && mark != game.Empty
+}
+
+// scheduleBotMove picks a thinking time and marks the bot move due at a future
+// tick, so MatchLoop plays it without blocking the match
+func (m *TicTacToeMatch) scheduleBotMove(s *TicTacToeState) {
+	if !s.botOnTurn() {
+		return
+	}
+	delayMs := s.BotDelay.MinMs
+	if spread := s.BotDelay.MaxMs - s.BotDelay.MinMs; spread > 0 {
+		delayMs += m.rng.Intn(spread + 1)
+	}
+	ticks := (int64(delayMs)*int64(m.tickRate) + 999) / 1000
+	s.BotMoveDueTick = s.Tick + max(ticks, 1)
+}
+
+// playDueBotMove makes the scheduled bot move once its tick has come
+func (m *TicTacToeMatch) playDueBotMove(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState) {
+	if s.BotMoveDueTick == 0 || s.Tick < s.BotMoveDueTick {
+		return
+	}
+	s.BotMoveDueTick = 0
+	if s.botOnTurn() {
+		m.makeBotMove(ctx, s, dispatcher)
+	}
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"math/rand"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+func init() {
+	Register("easy", func(rng *rand.Rand) Strategy { return &Random{rng: rng} })
+	Register("medium", func(rng *rand.Rand) Strategy { return &Mixed{rng: rng, Strength: 0.5, strong: &Perfect{}} })
+	Register("hard", func(rng *rand.Rand) Strategy { return &Perfect{} })
+}
+
+// Random plays a uniformly random legal move
+type Random struct {
+	rng *rand.Rand
+}
+
+// ChooseMove implements Strategy
+func (r *Random) ChooseMove(board game.Board, mark game.Mark, budget time.Duration) (game.Move, error) {
+	moves := board.LegalMoves()
+	if len(moves) == 0 {
+		return game.Move{}, ErrNoMoves
+	}
+	return moves[r.rng.Intn(len(moves))], nil
+}
+
+// Perfect plays the strongest move it can find. The classic board is solved
+// with full minimax; larger variants use an alpha-beta search within the
+// budget.
+type Perfect struct {
+	search *AlphaBeta // created on first use so classic games skip the table
+}
+
+// ChooseMove implements Strategy
+func (p *Perfect) ChooseMove(board game.Board, mark game.Mark, budget time.Duration) (game.Move, error) {
+	if board.IsClassic() {
+		if move, ok := game.BestMove(board, mark); ok {
+			return move, nil
+		}
+		return game.Move{}, ErrNoMoves
+	}
+	if p.search == nil {
+		p.search = &AlphaBeta{Searcher: NewSearcher(DefaultTableBits)}
+	}
+	return p.search.ChooseMove(board, mark, budget)
+}
+
+// Mixed plays the Perfect move with probability Strength and a random move
+// otherwise
+type Mixed struct {
+	rng      *rand.Rand
+	Strength float64
+	strong   *Perfect
+}
+
+// ChooseMove implements Strategy
+func (m *Mixed) ChooseMove(board game.Board, mark game.Mark, budget time.Duration) (game.Move, error) {
+	if m.rng.Float64() < m.Strength {
+		return m.strong.ChooseMove(board, mark, budget)
+	}
+	return (&Random{rng: m.rng}).ChooseMove(board, mark, budget)
+}
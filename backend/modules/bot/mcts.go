@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+const (
+	// DefaultMCTSIterations is the playout budget of the registered mcts bot
+	DefaultMCTSIterations = 2000
+	// DefaultExploration is the UCT exploration constant, sqrt(2)
+	DefaultExploration = math.Sqrt2
+)
+
+func init() {
+	Register("mcts", func(rng *rand.Rand) Strategy { return NewMCTS(rng, DefaultMCTSIterations) })
+}
+
+// MCTS plays the move a Monte Carlo tree search with UCT selection visits the
+// most. It is deterministic for a given rng seed as long as the iteration
+// budget, not the time budget, ends the search.
+type MCTS struct {
+	rng         *rand.Rand
+	Iterations  int     // playouts per move; 0 runs until the time budget is spent
+	Exploration float64 // UCT exploration constant
+}
+
+// NewMCTS returns an MCTS strategy with the given playout budget
+func NewMCTS(rng *rand.Rand, iterations int) *MCTS {
+	return &MCTS{rng: rng, Iterations: iterations, Exploration: DefaultExploration}
+}
+
+// mctsNode is a position in the search tree, reached by mark playing move
+type mctsNode struct {
+	move     game.Move
+	mark     game.Mark
+	parent   *mctsNode
+	children []*mctsNode
+	untried  []game.Move
+	visits   int
+	score    float64 // wins plus half of draws for mark
+	outcome  game.Outcome
+}
+
+// ChooseMove implements Strategy
+func (m *MCTS) ChooseMove(board game.Board, mark game.Mark, budget time.Duration) (game.Move, error) {
+	if mark != game.X && mark != game.O {
+		return game.Move{}, game.ErrInvalidMark
+	}
+	root := &mctsNode{mark: mark.Opponent(), untried: candidateMoves(&board)}
+	if len(root.untried) == 0 {
+		return game.Move{}, ErrNoMoves
+	}
+	if m.Iterations <= 0 && budget <= 0 {
+		budget = DefaultSearchBudget
+	}
+	deadline := time.Now().Add(budget)
+
+	for i := 0; m.Iterations <= 0 || i < m.Iterations; i++ {
+		if budget > 0 && i%64 == 0 && i > 0 && !time.Now().Before(deadline) {
+			break
+		}
+		b := board.Clone()
+
+		// Selection: descend through fully expanded nodes
+		node := root
+		for len(node.untried) == 0 && len(node.children) > 0 {
+			node = m.selectChild(node)
+			b.Cells[node.move.Row][node.move.Col] = node.mark
+		}
+
+		// Expansion: add one untried move
+		if len(node.untried) > 0 && !node.outcome.Finished() {
+			pick := m.rng.Intn(len(node.untried))
+			move := node.untried[pick]
+			node.untried[pick] = node.untried[len(node.untried)-1]
+			node.untried = node.untried[:len(node.untried)-1]
+
+			child := &mctsNode{move: move, mark: node.mark.Opponent(), parent: node}
+			b.Cells[move.Row][move.Col] = child.mark
+			child.outcome = b.OutcomeAfter(move)
+			if !child.outcome.Finished() {
+				child.untried = candidateMoves(&b)
+			}
+			node.children = append(node.children, child)
+			node = child
+		}
+
+		// Simulation and backpropagation
+		outcome := node.outcome
+		if !outcome.Finished() {
+			outcome = m.playout(&b, node.mark.Opponent())
+		}
+		for n := node; n != nil; n = n.parent {
+			n.visits++
+			switch outcome.Winner() {
+			case n.mark:
+				n.score++
+			case game.Empty:
+				n.score += 0.5
+			}
+		}
+	}
+
+	best := root.children[0]
+	for _, child := range root.children[1:] {
+		if child.visits > best.visits {
+			best = child
+		}
+	}
+	return best.move, nil
+}
+
+// selectChild picks the child with the highest UCT value
+func (m *MCTS) selectChild(node *mctsNode) *mctsNode {
+	logVisits := math.Log(float64(node.visits))
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	for _, child := range node.children {
+		value := child.score/float64(child.visits) + m.Exploration*math.Sqrt(logVisits/float64(child.visits))
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+// playout plays uniformly random moves from toMove until the game ends
+func (m *MCTS) playout(b *game.Board, toMove game.Mark) game.Outcome {
+	moves := b.LegalMoves()
+	for len(moves) > 0 {
+		pick := m.rng.Intn(len(moves))
+		move := moves[pick]
+		moves[pick] = moves[len(moves)-1]
+		moves = moves[:len(moves)-1]
+
+		b.Cells[move.Row][move.Col] = toMove
+		if b.WinsAt(move) {
+			return game.WinFor(toMove)
+		}
+		toMove = toMove.Opponent()
+	}
+	return game.Draw
+}
+
+// candidateMoves lists the moves worth expanding: every empty cell on small
+// boards, only cells near existing marks on large ones
+func candidateMoves(b *game.Board) []game.Move {
+	moves := b.LegalMoves()
+	if b.Size <= fullWidthSize || len(moves) == b.Size*b.Size {
+		return moves
+	}
+	var near []game.Move
+	for _, mv := range moves {
+		if nearMark(b, mv.Row, mv.Col) {
+			near = append(near, mv)
+		}
+	}
+	if len(near) == 0 {
+		return moves
+	}
+	return near
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"math/rand"
+	"testing"
+
+	"nakama-arena/modules/game"
+)
+
+// playMCTS plays a game between two MCTS bots seeded with seed and returns
+// the moves they chose
+func playMCTS(t *testing.T, seed int64, winLength int, rows ...string) []game.Move {
+	t.Helper()
+	board, mark := parsePosition(t, winLength, rows...)
+	players := map[game.Mark]*MCTS{
+		game.X: NewMCTS(rand.New(rand.NewSource(seed)), 200),
+		game.O: NewMCTS(rand.New(rand.NewSource(seed+1)), 200),
+	}
+	var moves []game.Move
+	for !board.Outcome().Finished() {
+		mv, err := players[mark].ChooseMove(board, mark, 0)
+		if err != nil {
+			t.Fatalf("ChooseMove: %v", err)
+		}
+		if err := board.Play(mv, mark); err != nil {
+			t.Fatalf("MCTS chose an illegal move %+v: %v", mv, err)
+		}
+		moves = append(moves, mv)
+		mark = mark.Opponent()
+	}
+	return moves
+}
+
+func TestMCTSDeterministic(t *testing.T) {
+	tests := []struct {
+		name      string
+		winLength int
+		rows      []string
+	}{
+		{"3x3 empty", 3, []string{"...", "...", "..."}},
+		{"5x5 midgame", 4, []string{".....", ".XO..", "..X..", "...O.", "....."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := playMCTS(t, 42, tt.winLength, tt.rows...)
+			for run := 0; run < 3; run++ {
+				again := playMCTS(t, 42, tt.winLength, tt.rows...)
+				if len(again) != len(first) {
+					t.Fatalf("run %d played %d moves, want %d", run, len(again), len(first))
+				}
+				for i := range first {
+					if again[i] != first[i] {
+						t.Fatalf("run %d move %d = %+v, want %+v", run, i, again[i], first[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestMCTSTakesWin(t *testing.T) {
+	tests := []struct {
+		name      string
+		winLength int
+		rows      []string
+		want      game.Move
+	}{
+		{"completes the row", 3, []string{"XX.", "OO.", "..."}, game.Move{Row: 0, Col: 2}},
+		{"completes the column", 3, []string{"X.O", "X..", ".O."}, game.Move{Row: 2, Col: 0}},
+		{"blocks the diagonal", 3, []string{"O.X", ".O.", "X.."}, game.Move{Row: 2, Col: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, mark := parsePosition(t, tt.winLength, tt.rows...)
+			mv, err := NewMCTS(rand.New(rand.NewSource(7)), DefaultMCTSIterations).ChooseMove(board, mark, 0)
+			if err != nil {
+				t.Fatalf("ChooseMove: %v", err)
+			}
+			if mv != tt.want {
+				t.Fatalf("ChooseMove = %+v, want %+v", mv, tt.want)
+			}
+		})
+	}
+}
+
+func TestMCTSNoMoves(t *testing.T) {
+	board, mark := parsePosition(t, 3, "XOX", "XOO", "OXX")
+	if _, err := NewMCTS(rand.New(rand.NewSource(1)), 10).ChooseMove(board, mark, 0); err != ErrNoMoves {
+		t.Fatalf("ChooseMove on a full board = %v, want %v", err, ErrNoMoves)
+	}
+}
@@ -0,0 +1,386 @@
+package bot
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+const (
+	// winScore is the score of a won position; quicker wins score higher
+	winScore = 1 << 20
+	// mateThreshold separates proven results from heuristic evaluations
+	mateThreshold = winScore - game.MaxSize*game.MaxSize - 1
+	// maxEval keeps heuristic evaluations clear of proven results
+	maxEval = winScore / 2
+
+	// nodeCheckInterval is how many nodes are searched between budget checks
+	nodeCheckInterval = 1024
+	// neighbourRadius limits candidate moves on large boards to cells this
+	// close to an existing mark
+	neighbourRadius = 2
+	// fullWidthSize is the largest board on which every empty cell is searched
+	fullWidthSize = 5
+
+	// DefaultSearchBudget is used by strategies asked to move without a budget
+	DefaultSearchBudget = time.Second
+)
+
+func init() {
+	Register("alphabeta", func(rng *rand.Rand) Strategy { return &AlphaBeta{Searcher: NewSearcher(DefaultTableBits)} })
+}
+
+// SearchLimits bounds a search; zero values mean no limit
+type SearchLimits struct {
+	Budget   time.Duration // wall-clock time
+	MaxNodes int64         // positions visited
+	MaxDepth int           // plies searched
+}
+
+// SearchResult is the outcome of a search
+type SearchResult struct {
+	Move  game.Move
+	Score int   // from the searching mark's point of view
+	Depth int   // deepest iteration that completed
+	Nodes int64 // positions visited
+}
+
+// Searcher runs iterative-deepening alpha-beta searches. Its transposition
+// table carries over between searches, so reuse one searcher per game.
+type Searcher struct {
+	table *transpositionTable
+
+	// Per-search state
+	board    game.Board
+	keys     *zobristKeys
+	hash     uint64
+	empty    int
+	history  []int
+	nodes    int64
+	limits   SearchLimits
+	deadline time.Time
+	stopped  bool
+	rootMove int
+}
+
+// NewSearcher returns a searcher with a 2^tableBits entry transposition table
+func NewSearcher(tableBits int) *Searcher {
+	return &Searcher{table: newTranspositionTable(tableBits)}
+}
+
+// Search finds the best move for mark within limits. It deepens one ply at a
+// time and returns the result of the deepest iteration that completed, so
+// running out of budget still yields a sensible move.
+func (s *Searcher) Search(board game.Board, mark game.Mark, limits SearchLimits) (SearchResult, error) {
+	if mark != game.X && mark != game.O {
+		return SearchResult{}, game.ErrInvalidMark
+	}
+	s.board = board.Clone()
+	s.keys = zobristFor(board.Size)
+	s.hash = s.keys.hash(&s.board, mark)
+	s.empty = len(s.board.LegalMoves())
+	s.history = make([]int, board.Size*board.Size)
+	s.nodes = 0
+	s.limits = limits
+	s.stopped = false
+	if limits.Budget > 0 {
+		s.deadline = time.Now().Add(limits.Budget)
+	}
+	if s.empty == 0 {
+		return SearchResult{}, ErrNoMoves
+	}
+
+	// Fall back to the first ordered move if not even depth one completes
+	first := s.orderedMoves(mark, -1)[0]
+	result := SearchResult{Move: s.move(first)}
+
+	maxDepth := s.empty
+	if limits.MaxDepth > 0 && limits.MaxDepth < maxDepth {
+		maxDepth = limits.MaxDepth
+	}
+	for depth := 1; depth <= maxDepth; depth++ {
+		s.rootMove = -1
+		score := s.negamax(mark, depth, 0, -winScore-1, winScore+1)
+		if s.stopped || s.rootMove < 0 {
+			break
+		}
+		result.Move = s.move(s.rootMove)
+		result.Score = score
+		result.Depth = depth
+
+		// A proven win or loss will not change with more depth
+		if score >= mateThreshold || score <= -mateThreshold {
+			break
+		}
+	}
+	result.Nodes = s.nodes
+	return result, nil
+}
+
+// negamax returns the score of the position for mark, the side to move
+func (s *Searcher) negamax(mark game.Mark, depth, ply int, alpha, beta int) int {
+	s.nodes++
+	if s.nodes%nodeCheckInterval == 0 && s.outOfBudget() {
+		s.stopped = true
+	}
+	if s.stopped {
+		return 0
+	}
+
+	// Reuse earlier results for this position; the root always searches so it
+	// can report a move
+	ttMove := -1
+	alphaOrig := alpha
+	if entry, ok := s.table.probe(s.hash); ok {
+		ttMove = int(entry.move)
+		if ply > 0 && int(entry.depth) >= depth {
+			score := fromTable(int(entry.score), ply)
+			switch entry.bound {
+			case boundExact:
+				return score
+			case boundLower:
+				alpha = max(alpha, score)
+			case boundUpper:
+				beta = min(beta, score)
+			}
+			if alpha >= beta {
+				return score
+			}
+		}
+	}
+
+	if depth == 0 {
+		return s.evaluate(mark)
+	}
+
+	best, bestMove := -winScore-1, -1
+	for _, index := range s.orderedMoves(mark, ttMove) {
+		mv := s.move(index)
+		s.play(index, mark)
+		var score int
+		switch {
+		case s.board.WinsAt(mv):
+			score = winScore - ply - 1
+		case s.empty == 0:
+			score = 0
+		default:
+			score = -s.negamax(mark.Opponent(), depth-1, ply+1, -beta, -alpha)
+		}
+		s.undo(index, mark)
+		if s.stopped {
+			return 0
+		}
+
+		if score > best {
+			best, bestMove = score, index
+			if ply == 0 {
+				s.rootMove = index
+			}
+		}
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			s.history[index] += depth * depth
+			break
+		}
+	}
+
+	bound := boundExact
+	switch {
+	case best <= alphaOrig:
+		bound = boundUpper
+	case best >= beta:
+		bound = boundLower
+	}
+	s.table.store(ttEntry{
+		key:   s.hash,
+		score: int32(toTable(best, ply)),
+		move:  int16(bestMove),
+		depth: int16(depth),
+		bound: bound,
+	})
+	return best
+}
+
+// outOfBudget reports whether the time or node limit has been reached
+func (s *Searcher) outOfBudget() bool {
+	if s.limits.MaxNodes > 0 && s.nodes >= s.limits.MaxNodes {
+		return true
+	}
+	return s.limits.Budget > 0 && !time.Now().Before(s.deadline)
+}
+
+// play places mark in the row-major cell index and updates the hash
+func (s *Searcher) play(index int, mark game.Mark) {
+	s.board.Cells[index/s.board.Size][index%s.board.Size] = mark
+	s.hash ^= s.keys.cell(index, mark) ^ s.keys.side
+	s.empty--
+}
+
+// undo reverts play
+func (s *Searcher) undo(index int, mark game.Mark) {
+	s.board.Cells[index/s.board.Size][index%s.board.Size] = game.Empty
+	s.hash ^= s.keys.cell(index, mark) ^ s.keys.side
+	s.empty++
+}
+
+// move converts a row-major cell index into a move
+func (s *Searcher) move(index int) game.Move {
+	return game.Move{Row: index / s.board.Size, Col: index % s.board.Size}
+}
+
+// orderedMoves returns candidate cells, most promising first: the table's
+// best move, immediate wins, blocks of the opponent's wins, then cells that
+// caused cutoffs before and cells near the centre. Large boards only
+// consider cells near existing marks.
+func (s *Searcher) orderedMoves(mark game.Mark, ttMove int) []int {
+	b := &s.board
+	size := b.Size
+	centre := (size - 1) / 2
+
+	type candidate struct {
+		index, score int
+	}
+	var candidates []candidate
+	collect := func(restrict bool) {
+		for r := 0; r < size; r++ {
+			for c := 0; c < size; c++ {
+				if b.Cells[r][c] != game.Empty || (restrict && !nearMark(b, r, c)) {
+					continue
+				}
+				index := r*size + c
+				mv := game.Move{Row: r, Col: c}
+				score := s.history[index] - abs(r-centre) - abs(c-centre)
+				switch {
+				case index == ttMove:
+					score += 1 << 30
+				case s.winsWith(mv, mark):
+					score += 1 << 29
+				case s.winsWith(mv, mark.Opponent()):
+					score += 1 << 28
+				}
+				candidates = append(candidates, candidate{index: index, score: score})
+			}
+		}
+	}
+
+	// Widen to the whole board when every cell near a mark is taken
+	restrict := size > fullWidthSize && s.empty < size*size
+	if collect(restrict); restrict && len(candidates) == 0 {
+		collect(false)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+	moves := make([]int, len(candidates))
+	for i, cand := range candidates {
+		moves[i] = cand.index
+	}
+	return moves
+}
+
+// nearMark reports whether any mark lies within neighbourRadius of the cell
+func nearMark(b *game.Board, row, col int) bool {
+	for r := max(row-neighbourRadius, 0); r <= min(row+neighbourRadius, b.Size-1); r++ {
+		for c := max(col-neighbourRadius, 0); c <= min(col+neighbourRadius, b.Size-1); c++ {
+			if b.Cells[r][c] != game.Empty {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// winsWith reports whether mark would complete a line by playing mv
+func (s *Searcher) winsWith(mv game.Move, mark game.Mark) bool {
+	s.board.Cells[mv.Row][mv.Col] = mark
+	wins := s.board.WinsAt(mv)
+	s.board.Cells[mv.Row][mv.Col] = game.Empty
+	return wins
+}
+
+// evaluate scores an unfinished position for mark by counting every window of
+// WinLength cells that only one side occupies, weighting fuller windows
+// exponentially
+func (s *Searcher) evaluate(mark game.Mark) int {
+	b := &s.board
+	k := b.WinLength
+	score := 0
+	for _, d := range [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+		for r := 0; r < b.Size; r++ {
+			for c := 0; c < b.Size; c++ {
+				endR, endC := r+d[0]*(k-1), c+d[1]*(k-1)
+				if endR < 0 || endR >= b.Size || endC < 0 || endC >= b.Size {
+					continue
+				}
+				own, opp := 0, 0
+				for i := 0; i < k; i++ {
+					switch b.Cells[r+d[0]*i][c+d[1]*i] {
+					case game.Empty:
+					case mark:
+						own++
+					default:
+						opp++
+					}
+				}
+				switch {
+				case opp == 0 && own > 0:
+					score += windowWeight(own)
+				case own == 0 && opp > 0:
+					score -= windowWeight(opp)
+				}
+			}
+		}
+	}
+	return max(-maxEval, min(maxEval, score))
+}
+
+// windowWeight values a window holding count marks of one side
+func windowWeight(count int) int {
+	return 1 << min(3*count, 30)
+}
+
+// toTable converts a score to be independent of the ply it was found at, so
+// proven results can be reused at other depths
+func toTable(score, ply int) int {
+	switch {
+	case score >= mateThreshold:
+		return score + ply
+	case score <= -mateThreshold:
+		return score - ply
+	}
+	return score
+}
+
+// fromTable reverses toTable for the current ply
+func fromTable(score, ply int) int {
+	switch {
+	case score >= mateThreshold:
+		return score - ply
+	case score <= -mateThreshold:
+		return score + ply
+	}
+	return score
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// AlphaBeta plays the best move an iterative-deepening alpha-beta search finds
+// within the time budget
+type AlphaBeta struct {
+	Searcher *Searcher
+}
+
+// ChooseMove implements Strategy
+func (a *AlphaBeta) ChooseMove(board game.Board, mark game.Mark, budget time.Duration) (game.Move, error) {
+	if budget <= 0 {
+		budget = DefaultSearchBudget
+	}
+	result, err := a.Searcher.Search(board, mark, SearchLimits{Budget: budget})
+	return result.Move, err
+}
@@ -0,0 +1,312 @@
+package bot
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+var (
+	benchBudget = flag.Duration("budget", 500*time.Millisecond, "time budget per alpha-beta search on boards minimax cannot solve")
+	benchDepth  = flag.Int("depth", 0, "depth limit for alpha-beta searches, 0 for none")
+)
+
+// position is a board to benchmark, given as rows of '.', 'X' and 'O'
+type position struct {
+	name      string
+	winLength int
+	rows      []string
+	minimax   bool // whether plain minimax finishes in reasonable time
+}
+
+var positions = []position{
+	{name: "3x3 empty", winLength: 3, rows: []string{"...", "...", "..."}, minimax: true},
+	{name: "3x3 midgame", winLength: 3, rows: []string{"X..", ".O.", "..X"}, minimax: true},
+	{name: "4x4 endgame", winLength: 4, rows: []string{"XO.X", ".XO.", "O.X.", "...O"}, minimax: true},
+	{name: "7x7 opening", winLength: 4, rows: []string{".......", ".......", "..XO...", "...X...", "....O..", ".......", "......."}},
+	{name: "15x15 gomoku", winLength: 5, rows: []string{
+		"...............", "...............", "...............", "...............",
+		"...............", "......O........", ".....XXO.......", "......XO.......",
+		".......X.......", "...............", "...............", "...............",
+		"...............", "...............", "...............",
+	}},
+}
+
+// parsePosition builds the board from rows and works out whose turn it is
+func parsePosition(tb testing.TB, winLength int, rows ...string) (game.Board, game.Mark) {
+	tb.Helper()
+	board, err := game.NewBoard(len(rows), winLength)
+	if err != nil {
+		tb.Fatalf("NewBoard(%d, %d): %v", len(rows), winLength, err)
+	}
+	xCount, oCount := 0, 0
+	for i, row := range rows {
+		if len(row) != board.Size {
+			tb.Fatalf("row %d has %d cells, want %d", i, len(row), board.Size)
+		}
+		for j, cell := range row {
+			switch cell {
+			case 'X':
+				board.Cells[i][j] = game.X
+				xCount++
+			case 'O':
+				board.Cells[i][j] = game.O
+				oCount++
+			}
+		}
+	}
+	if xCount > oCount {
+		return board, game.O
+	}
+	return board, game.X
+}
+
+// perfectOutcome plays the game out with game.BestMove for both sides
+func perfectOutcome(t *testing.T, board game.Board, toMove game.Mark) game.Outcome {
+	t.Helper()
+	for !board.Outcome().Finished() {
+		mv, ok := game.BestMove(board, toMove)
+		if !ok {
+			t.Fatal("BestMove found no move before the game ended")
+		}
+		if err := board.Play(mv, toMove); err != nil {
+			t.Fatalf("BestMove chose an illegal move %+v: %v", mv, err)
+		}
+		toMove = toMove.Opponent()
+	}
+	return board.Outcome()
+}
+
+// outcomeAfter plays mv for toMove and returns the result of perfect play from
+// there
+func outcomeAfter(t *testing.T, board game.Board, toMove game.Mark, mv game.Move) game.Outcome {
+	t.Helper()
+	b := board.Clone()
+	if err := b.Play(mv, toMove); err != nil {
+		t.Fatalf("illegal move %+v: %v", mv, err)
+	}
+	return perfectOutcome(t, b, toMove.Opponent())
+}
+
+func TestSearchAgreesWithMinimax(t *testing.T) {
+	positions := [][]string{
+		{"...", "...", "..."},
+		{"X..", "...", "..."},
+		{"X..", ".O.", "..X"},
+		{"XO.", "...", "..."},
+		{".X.", "...", "..."},
+		{"XX.", "OO.", "..."},
+		{"X.O", ".X.", "..."},
+		{"XOX", ".O.", "..."},
+		{"X..", "OXO", "..."},
+		{"XOX", "XOO", "..."},
+	}
+	for _, rows := range positions {
+		t.Run(strings.Join(rows, "/"), func(t *testing.T) {
+			board, toMove := parsePosition(t, 3, rows...)
+			want, ok := game.BestMove(board, toMove)
+			if !ok {
+				t.Fatal("BestMove found no move")
+			}
+			result, err := NewSearcher(DefaultTableBits).Search(board, toMove, SearchLimits{})
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			// Several moves can be optimal, so compare what they lead to
+			if got, wantOutcome := outcomeAfter(t, board, toMove, result.Move), outcomeAfter(t, board, toMove, want); got != wantOutcome {
+				t.Fatalf("Search chose %+v leading to %d, minimax chose %+v leading to %d", result.Move, got, want, wantOutcome)
+			}
+		})
+	}
+}
+
+func TestSearchReusedTable(t *testing.T) {
+	// One searcher per game keeps its table, which must not leak results
+	// between positions
+	searcher := NewSearcher(DefaultTableBits)
+	board, toMove := parsePosition(t, 3, "...", "...", "...")
+	for !board.Outcome().Finished() {
+		result, err := searcher.Search(board, toMove, SearchLimits{})
+		if err != nil {
+			t.Fatalf("Search: %v", err)
+		}
+		if err := board.Play(result.Move, toMove); err != nil {
+			t.Fatalf("Search chose an illegal move %+v: %v", result.Move, err)
+		}
+		toMove = toMove.Opponent()
+	}
+	if got := board.Outcome(); got != game.Draw {
+		t.Fatalf("self-play with a shared table ended in %d, want a draw", got)
+	}
+}
+
+func TestSearchGomokuTactics(t *testing.T) {
+	empty := strings.Repeat(".", 15)
+	gomoku := func(rows map[int]string) []string {
+		board := make([]string, 15)
+		for i := range board {
+			board[i] = empty
+			if row, ok := rows[i]; ok {
+				board[i] = row
+			}
+		}
+		return board
+	}
+	tests := []struct {
+		name string
+		rows []string
+		want game.Move
+	}{
+		{
+			name: "completes five",
+			rows: gomoku(map[int]string{
+				6:  "...OXXXX.......",
+				7:  "....OOO........",
+				8:  "......O........",
+				12: "............X..",
+			}),
+			want: game.Move{Row: 6, Col: 8},
+		},
+		{
+			name: "blocks a four",
+			rows: gomoku(map[int]string{
+				5: "......X........",
+				6: ".....OOOOX.....",
+				7: "......X........",
+				8: ".......X.......",
+			}),
+			want: game.Move{Row: 6, Col: 4},
+		},
+		{
+			name: "blocks a diagonal four",
+			rows: gomoku(map[int]string{
+				2: "..X............",
+				3: "...O...........",
+				4: "....O..........",
+				5: ".....O.........",
+				6: "......O..XX....",
+				7: "..........X....",
+			}),
+			want: game.Move{Row: 7, Col: 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			board, toMove := parsePosition(t, 5, tt.rows...)
+			result, err := NewSearcher(DefaultTableBits).Search(board, toMove, SearchLimits{Budget: 500 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if result.Move != tt.want {
+				t.Fatalf("Search chose %+v, want %+v", result.Move, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	board, toMove := parsePosition(t, positions[4].winLength, positions[4].rows...)
+	tests := []struct {
+		name   string
+		limits SearchLimits
+		check  func(t *testing.T, result SearchResult, elapsed time.Duration)
+	}{
+		{
+			name:   "node limit",
+			limits: SearchLimits{MaxNodes: 2000},
+			check: func(t *testing.T, result SearchResult, _ time.Duration) {
+				// The limit is checked every nodeCheckInterval nodes
+				if result.Nodes > 2000+nodeCheckInterval {
+					t.Fatalf("searched %d nodes, want at most about 2000", result.Nodes)
+				}
+			},
+		},
+		{
+			name:   "time budget",
+			limits: SearchLimits{Budget: 50 * time.Millisecond},
+			check: func(t *testing.T, _ SearchResult, elapsed time.Duration) {
+				if elapsed > time.Second {
+					t.Fatalf("search took %v with a 50ms budget", elapsed)
+				}
+			},
+		},
+		{
+			name:   "depth limit",
+			limits: SearchLimits{MaxDepth: 2},
+			check: func(t *testing.T, result SearchResult, _ time.Duration) {
+				if result.Depth != 2 {
+					t.Fatalf("searched to depth %d, want 2", result.Depth)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			result, err := NewSearcher(DefaultTableBits).Search(board, toMove, tt.limits)
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatalf("Search: %v", err)
+			}
+			if err := board.Validate(result.Move); err != nil {
+				t.Fatalf("Search returned an illegal move %+v: %v", result.Move, err)
+			}
+			tt.check(t, result, elapsed)
+		})
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	full, mark := parsePosition(t, 3, "XOX", "XOO", "OXX")
+	if _, err := NewSearcher(DefaultTableBits).Search(full, mark, SearchLimits{}); err != ErrNoMoves {
+		t.Fatalf("Search on a full board = %v, want %v", err, ErrNoMoves)
+	}
+	empty, _ := parsePosition(t, 3, "...", "...", "...")
+	if _, err := NewSearcher(DefaultTableBits).Search(empty, game.Empty, SearchLimits{}); err != game.ErrInvalidMark {
+		t.Fatalf("Search for an empty mark = %v, want %v", err, game.ErrInvalidMark)
+	}
+}
+
+// BenchmarkMinimax runs the plain minimax search on the boards it can solve
+func BenchmarkMinimax(b *testing.B) {
+	for _, p := range positions {
+		if !p.minimax {
+			continue
+		}
+		b.Run(p.name, func(b *testing.B) {
+			board, toMove := parsePosition(b, p.winLength, p.rows...)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				game.BestMove(board, toMove)
+			}
+		})
+	}
+}
+
+// BenchmarkAlphaBeta runs the alpha-beta searcher on every board. Boards
+// minimax can solve are searched to the end, the rest within -budget.
+func BenchmarkAlphaBeta(b *testing.B) {
+	for _, p := range positions {
+		b.Run(p.name, func(b *testing.B) {
+			board, toMove := parsePosition(b, p.winLength, p.rows...)
+			limits := SearchLimits{MaxDepth: *benchDepth}
+			if !p.minimax {
+				limits.Budget = *benchBudget
+			}
+			var result SearchResult
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// A fresh table per run so iterations do not share results
+				var err error
+				if result, err = NewSearcher(DefaultTableBits).Search(board, toMove, limits); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(result.Nodes), "nodes")
+			b.ReportMetric(float64(result.Depth), "depth")
+		})
+	}
+}
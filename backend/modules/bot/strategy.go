@@ -0,0 +1,69 @@
+// Package bot chooses moves for computer players. Strategies are registered by
+// name so the match handler, RPCs and offline tools can pick one at runtime.
+package bot
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+// Errors returned when creating strategies or choosing moves
+var (
+	ErrUnknownStrategy = errors.New("unknown bot strategy")
+	ErrNoMoves         = errors.New("no legal moves")
+)
+
+// Strategy picks the move a bot plays
+type Strategy interface {
+	// ChooseMove returns a legal move for mark, spending at most budget. The
+	// board must not be modified.
+	ChooseMove(board game.Board, mark game.Mark, budget time.Duration) (game.Move, error)
+}
+
+// Factory creates a strategy drawing any randomness from rng. Strategies are
+// not safe for concurrent use, so each match or request creates its own.
+type Factory func(rng *rand.Rand) Strategy
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a strategy available under name. It panics if the name is
+// already taken, so registrations belong in init functions.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("bot: Register called twice for strategy " + name)
+	}
+	registry[name] = factory
+}
+
+// New creates the strategy registered under name
+func New(name string, rng *rand.Rand) (Strategy, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownStrategy
+	}
+	return factory(rng), nil
+}
+
+// Names returns the registered strategy names in sorted order
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
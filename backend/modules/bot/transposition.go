@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"math/rand"
+	"sync"
+
+	"nakama-arena/modules/game"
+)
+
+// DefaultTableBits sizes a searcher's transposition table at 2^bits entries
+const DefaultTableBits = 16
+
+// zobristKeys holds one random key per cell and mark, plus one for the side
+// to move, so positions hash by XOR-ing the keys of their marks
+type zobristKeys struct {
+	cells [][2]uint64 // indexed by row-major cell, then mark-1
+	side  uint64      // XOR-ed in when O is to move
+}
+
+var (
+	zobristMu     sync.Mutex
+	zobristBySize = make(map[int]*zobristKeys)
+)
+
+// zobristFor returns the keys for boards of the given size. Keys come from a
+// fixed seed so hashes are stable across searchers.
+func zobristFor(size int) *zobristKeys {
+	zobristMu.Lock()
+	defer zobristMu.Unlock()
+	if keys, ok := zobristBySize[size]; ok {
+		return keys
+	}
+	rng := rand.New(rand.NewSource(int64(size)))
+	keys := &zobristKeys{cells: make([][2]uint64, size*size), side: rng.Uint64()}
+	for i := range keys.cells {
+		keys.cells[i] = [2]uint64{rng.Uint64(), rng.Uint64()}
+	}
+	zobristBySize[size] = keys
+	return keys
+}
+
+// cell returns the key for mark in the row-major cell index
+func (z *zobristKeys) cell(index int, mark game.Mark) uint64 {
+	return z.cells[index][mark-1]
+}
+
+// hash computes the key of a whole position with toMove to play
+func (z *zobristKeys) hash(b *game.Board, toMove game.Mark) uint64 {
+	var h uint64
+	for i, row := range b.Cells {
+		for j, mark := range row {
+			if mark != game.Empty {
+				h ^= z.cell(i*b.Size+j, mark)
+			}
+		}
+	}
+	if toMove == game.O {
+		h ^= z.side
+	}
+	return h
+}
+
+// Bounds stored with a transposition table score
+const (
+	boundExact uint8 = iota + 1
+	boundLower
+	boundUpper
+)
+
+// ttEntry is a remembered search result for one position
+type ttEntry struct {
+	key   uint64
+	score int32
+	move  int16 // row-major index of the best move, -1 if none
+	depth int16
+	bound uint8 // 0 marks an empty slot
+}
+
+// transpositionTable is a fixed-size, always-replace hash table of search results
+type transpositionTable struct {
+	entries []ttEntry
+	mask    uint64
+}
+
+func newTranspositionTable(bits int) *transpositionTable {
+	if bits <= 0 {
+		bits = DefaultTableBits
+	}
+	size := uint64(1) << bits
+	return &transpositionTable{entries: make([]ttEntry, size), mask: size - 1}
+}
+
+// probe returns the entry stored for key, if any
+func (t *transpositionTable) probe(key uint64) (ttEntry, bool) {
+	entry := t.entries[key&t.mask]
+	return entry, entry.bound != 0 && entry.key == key
+}
+
+// store records a result, keeping deeper results for the same position
+func (t *transpositionTable) store(entry ttEntry) {
+	slot := &t.entries[entry.key&t.mask]
+	if slot.bound != 0 && slot.key == entry.key && slot.depth > entry.depth {
+		return
+	}
+	*slot = entry
+}
@@ -0,0 +1,78 @@
+package main
+
+import "time"
+
+const (
+	// DefaultMoveTimeSec is the per-move limit used when a match does not set one
+	DefaultMoveTimeSec = 60
+)
+
+// clocked reports whether any time control is enabled for the match
+func (s *TicTacToeState) clocked() bool {
+	return s.MoveTimeMs > 0 || s.GameTimeMs > 0
+}
+
+// startClocks gives every player a full game clock and starts the first turn
+func (s *TicTacToeState) startClocks(now time.Time) {
+	s.TurnStartedAt = now
+	if s.GameTimeMs <= 0 {
+		return
+	}
+	s.Clocks = make(map[string]int64, len(s.Players))
+	for playerID := range s.Players {
+		s.Clocks[playerID] = s.GameTimeMs
+	}
+}
+
+// chargeClock deducts the time userID spent on the move that just finished and
+// adds the Fischer increment
+func (s *TicTacToeState) chargeClock(userID string, now time.Time) {
+	if s.GameTimeMs <= 0 || userID == "bot" {
+		return
+	}
+	elapsed := now.Sub(s.TurnStartedAt).Milliseconds()
+	s.Clocks[userID] = s.Clocks[userID] - elapsed + s.IncrementMs
+}
+
+// timeLeft returns the milliseconds left on the per-move and game clocks for
+// the player to move; -1 means that clock is disabled
+func (s *TicTacToeState) timeLeft(now time.Time) (moveMs int64, gameMs int64) {
+	elapsed := now.Sub(s.TurnStartedAt).Milliseconds()
+	moveMs, gameMs = -1, -1
+	if s.MoveTimeMs > 0 {
+		moveMs = max(s.MoveTimeMs-elapsed, 0)
+	}
+	if s.GameTimeMs > 0 {
+		gameMs = max(s.Clocks[s.playerWithMark(s.CurrentTurn)]-elapsed, 0)
+	}
+	return moveMs, gameMs
+}
+
+// flagged returns the player to move if they have run out of time. Bots never
+// flag because they always move within the tick.
+func (s *TicTacToeState) flagged(now time.Time) (string, bool) {
+	userID := s.playerWithMark(s.CurrentTurn)
+	if userID == "" || userID == "bot" {
+		return "", false
+	}
+	moveMs, gameMs := s.timeLeft(now)
+	return userID, moveMs == 0 || gameMs == 0
+}
+
+// clockMessage builds the per-tick clock broadcast
+func (s *TicTacToeState) clockMessage(now time.Time) clockMessage {
+	moveMs, gameMs := s.timeLeft(now)
+	clocks := make(map[string]int64, len(s.Clocks))
+	for playerID, remaining := range s.Clocks {
+		clocks[playerID] = remaining
+	}
+	if gameMs >= 0 {
+		clocks[s.playerWithMark(s.CurrentTurn)] = gameMs
+	}
+	return clockMessage{
+		CurrentTurn:     s.CurrentTurn,
+		MoveRemainingMs: moveMs,
+		Clocks:          clocks,
+		IncrementMs:     s.IncrementMs,
+	}
+}
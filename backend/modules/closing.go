@@ -0,0 +1,59 @@
+package main
+
+import "time"
+
+const (
+	// DefaultCloseAfterSec is how long a completed match stays open for players
+	// to read the result, unless a rematch window keeps it open longer
+	DefaultCloseAfterSec = 10
+
+	// DefaultEmptyTimeoutSec is how long a match may run with nobody connected
+	// before it is abandoned
+	DefaultEmptyTimeoutSec = 60
+
+	// DefaultJoinTimeoutSec is how long the players a match was reserved for
+	// have to take their seats
+	DefaultJoinTimeoutSec = 30
+)
+
+// Reasons reported in closedMessage
+const (
+	CloseReasonComplete = "complete"
+	CloseReasonEmpty    = "empty"
+	CloseReasonShutdown = "shutdown"
+	CloseReasonNoShow   = "no_show"
+)
+
+// scheduleClose sets when a completed match closes, leaving room for the
+// rematch window
+func (s *TicTacToeState) scheduleClose(now time.Time, reason string) {
+	closeAt := now.Add(time.Duration(s.CloseAfterMs) * time.Millisecond)
+	if s.RematchDeadline.After(closeAt) {
+		closeAt = s.RematchDeadline
+	}
+	s.CloseAt = closeAt
+	s.CloseReason = reason
+}
+
+// closeReason reports whether the match should end now and why. Completed
+// matches close on schedule or as soon as everyone has left; running matches
+// close once nobody has been connected for the empty timeout, and reserved
+// matches once their players have not all joined by the join deadline.
+func (s *TicTacToeState) closeReason(now time.Time) (string, bool) {
+	if s.CloseReason == CloseReasonShutdown {
+		return s.CloseReason, !now.Before(s.CloseAt)
+	}
+	if s.MatchState == MatchStateComplete {
+		if len(s.presences) == 0 || !now.Before(s.CloseAt) {
+			return s.CloseReason, true
+		}
+		return "", false
+	}
+	if s.MatchState == MatchStateInit && !s.JoinDeadline.IsZero() && !now.Before(s.JoinDeadline) {
+		return CloseReasonNoShow, true
+	}
+	if len(s.presences) == 0 && now.Sub(s.IdleSince).Milliseconds() >= s.EmptyTimeoutMs {
+		return CloseReasonEmpty, true
+	}
+	return "", false
+}
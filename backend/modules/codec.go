@@ -0,0 +1,239 @@
+package main
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"nakama-arena/modules/game"
+)
+
+// Encodings a presence can pick with "encoding" in its join metadata
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+)
+
+// protoMessage is implemented by every match message so it can be exchanged
+// with presences that negotiated the protobuf encoding. The schema lives in
+// backend/proto/tictactoe.proto.
+type protoMessage interface {
+	marshalProto() []byte
+}
+
+// negotiateEncoding picks the wire encoding for a joining client
+func negotiateEncoding(metadata map[string]string) (string, bool) {
+	switch metadata["encoding"] {
+	case "", EncodingJSON:
+		return EncodingJSON, true
+	case EncodingProtobuf:
+		return EncodingProtobuf, true
+	}
+	return "", false
+}
+
+// appendInt appends a varint field, omitting proto3 defaults
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendSint appends a zigzag-encoded varint field for values that may be negative
+func appendSint(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeZigZag(v))
+}
+
+// appendBool appends a bool field, omitting false
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+// appendString appends a string field, omitting empty strings
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// appendMessage appends an embedded message field
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// appendIntMap appends a map<string, int64> field with keys in sorted order
+func appendIntMap[V ~int | ~int64](b []byte, num protowire.Number, m map[string]V) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, 1, k)
+		entry = appendInt(entry, 2, int64(m[k]))
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
+
+// appendBoard appends the board as an embedded Board message with packed cells
+func appendBoard(b []byte, num protowire.Number, board game.Board) []byte {
+	var cells []byte
+	for _, row := range board.Cells {
+		for _, cell := range row {
+			cells = protowire.AppendVarint(cells, uint64(cell))
+		}
+	}
+	var msg []byte
+	msg = appendInt(msg, 1, int64(board.Size))
+	msg = appendInt(msg, 2, int64(board.WinLength))
+	msg = protowire.AppendTag(msg, 3, protowire.BytesType)
+	msg = protowire.AppendBytes(msg, cells)
+	return appendMessage(b, num, msg)
+}
+
+// unmarshalProto decodes a MoveRequest, ignoring unknown fields
+func (r *moveRequest) unmarshalProto(b []byte) error {
+	*r = moveRequest{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if (num == 1 || num == 2) && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+			if num == 1 {
+				r.Row = int(int32(v))
+			} else {
+				r.Col = int(int32(v))
+			}
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func (r moveRequest) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(r.Row))
+	return appendInt(b, 2, int64(r.Col))
+}
+
+func (m statusMessage) marshalProto() []byte {
+	return appendString(nil, 1, m.Message)
+}
+
+func (m gameOverMessage) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Message)
+	b = appendString(b, 2, m.Reason)
+	b = appendString(b, 3, m.Winner)
+	b = appendInt(b, 4, int64(m.Outcome))
+	b = appendInt(b, 5, int64(m.Round))
+	b = appendInt(b, 6, int64(m.BestOf))
+	b = appendIntMap(b, 7, m.SeriesScore)
+	b = appendBool(b, 8, m.SeriesOver)
+	return appendString(b, 9, m.SeriesWinner)
+}
+
+func (m moveMadeMessage) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(m.Row))
+	b = appendInt(b, 2, int64(m.Col))
+	b = appendInt(b, 3, int64(m.Mark))
+	return appendInt(b, 4, int64(m.CurrentTurn))
+}
+
+func (m clockMessage) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(m.CurrentTurn))
+	b = appendSint(b, 2, m.MoveRemainingMs)
+	b = appendIntMap(b, 3, m.Clocks)
+	return appendInt(b, 4, m.IncrementMs)
+}
+
+func (m disconnectedMessage) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Message)
+	b = appendString(b, 2, m.UserID)
+	return appendInt(b, 3, m.SecondsRemaining)
+}
+
+func (m reconnectedMessage) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Message)
+	return appendString(b, 2, m.UserID)
+}
+
+func (m rematchMessage) marshalProto() []byte {
+	var b []byte
+	for _, userID := range m.Offers {
+		b = appendString(b, 1, userID)
+	}
+	return appendInt(b, 2, m.SecondsRemaining)
+}
+
+func (m closedMessage) marshalProto() []byte {
+	var b []byte
+	b = appendString(b, 1, m.Message)
+	b = appendString(b, 2, m.Reason)
+	return appendInt(b, 3, m.SecondsRemaining)
+}
+
+func (m rejectionMessage) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, m.OpCode)
+	b = appendString(b, 2, m.Code)
+	return appendString(b, 3, m.Message)
+}
+
+func (m stateSnapshot) marshalProto() []byte {
+	var b []byte
+	b = appendInt(b, 1, int64(m.ProtocolVersion))
+	b = appendBoard(b, 2, m.Board)
+	b = appendInt(b, 3, int64(m.CurrentTurn))
+	b = appendInt(b, 4, int64(m.Winner))
+	b = appendIntMap(b, 5, m.Players)
+	b = appendInt(b, 6, int64(m.MatchState))
+	b = appendBool(b, 7, m.BotMatch)
+	b = appendInt(b, 8, m.MoveTimeMs)
+	b = appendInt(b, 9, m.GameTimeMs)
+	b = appendInt(b, 10, m.IncrementMs)
+	b = appendSint(b, 11, m.MoveRemainingMs)
+	b = appendIntMap(b, 12, m.Clocks)
+	b = appendIntMap(b, 13, m.Disconnected)
+	b = appendBool(b, 14, m.Spectator)
+	b = appendInt(b, 15, int64(m.SpectatorCount))
+	b = appendInt(b, 16, int64(m.BestOf))
+	b = appendInt(b, 17, int64(m.Round))
+	b = appendIntMap(b, 18, m.SeriesScore)
+	for _, userID := range m.RematchOffers {
+		b = appendString(b, 19, userID)
+	}
+	b = appendInt(b, 20, m.RematchSecondsRemaining)
+	return appendInt(b, 21, int64(m.BotLevel))
+}
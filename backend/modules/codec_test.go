@@ -0,0 +1,321 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"nakama-arena/modules/game"
+)
+
+// protoField is one field declaration from tictactoe.proto
+type protoField struct {
+	name     string
+	typ      string // scalar or message type, the value type for maps
+	repeated bool
+	isMap    bool
+}
+
+var (
+	protoMessageRE = regexp.MustCompile(`(?s)message (\w+) \{(.*?)\}`)
+	protoFieldRE   = regexp.MustCompile(`(repeated )?(map<string, (\w+)>|\w+) (\w+) = (\d+);`)
+)
+
+// loadSchema parses the message declarations of backend/proto/tictactoe.proto
+func loadSchema(t *testing.T) map[string]map[protowire.Number]protoField {
+	t.Helper()
+	src, err := os.ReadFile("../proto/tictactoe.proto")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+	schema := make(map[string]map[protowire.Number]protoField)
+	for _, msg := range protoMessageRE.FindAllStringSubmatch(string(src), -1) {
+		fields := make(map[protowire.Number]protoField)
+		for _, f := range protoFieldRE.FindAllStringSubmatch(msg[2], -1) {
+			num, _ := strconv.Atoi(f[5])
+			field := protoField{name: f[4], typ: f[2], repeated: f[1] != ""}
+			if f[3] != "" {
+				field.typ, field.isMap = f[3], true
+			}
+			fields[protowire.Number(num)] = field
+		}
+		schema[msg[1]] = fields
+	}
+	return schema
+}
+
+// decodeScalar converts a varint to the Go value of a proto scalar type
+func decodeScalar(t *testing.T, typ string, v uint64) any {
+	t.Helper()
+	switch typ {
+	case "int32":
+		return int64(int32(v))
+	case "int64":
+		return int64(v)
+	case "sint64":
+		return protowire.DecodeZigZag(v)
+	case "bool":
+		return protowire.DecodeBool(v)
+	}
+	t.Fatalf("unsupported scalar type %s", typ)
+	return nil
+}
+
+// decodeProto decodes b as the named message of schema into a map of field
+// names to values, failing on fields or wire types the schema does not declare
+func decodeProto(t *testing.T, schema map[string]map[protowire.Number]protoField, message string, b []byte) map[string]any {
+	t.Helper()
+	fields, ok := schema[message]
+	if !ok {
+		t.Fatalf("schema has no message %s", message)
+	}
+	out := make(map[string]any)
+	lastKey := make(map[string]string)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("%s: bad tag: %v", message, protowire.ParseError(n))
+		}
+		b = b[n:]
+		field, ok := fields[num]
+		if !ok {
+			t.Fatalf("%s: field %d is not in the schema", message, num)
+		}
+		if _, seen := out[field.name]; seen && !field.repeated && !field.isMap {
+			t.Fatalf("%s.%s encoded twice", message, field.name)
+		}
+
+		if typ == protowire.VarintType {
+			if field.repeated || field.isMap || field.typ == "string" {
+				t.Fatalf("%s.%s sent as a varint", message, field.name)
+			}
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				t.Fatalf("%s.%s: %v", message, field.name, protowire.ParseError(n))
+			}
+			b = b[n:]
+			out[field.name] = decodeScalar(t, field.typ, v)
+			continue
+		}
+		if typ != protowire.BytesType {
+			t.Fatalf("%s.%s has wire type %d", message, field.name, typ)
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			t.Fatalf("%s.%s: %v", message, field.name, protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		switch {
+		case field.isMap:
+			entry := decodeProto(t, map[string]map[protowire.Number]protoField{
+				"entry": {1: {name: "key", typ: "string"}, 2: {name: "value", typ: field.typ}},
+			}, "entry", v)
+			key, _ := entry["key"].(string)
+			value, _ := entry["value"].(int64)
+			if prev, ok := lastKey[field.name]; ok && key <= prev {
+				t.Fatalf("%s.%s key %q follows %q", message, field.name, key, prev)
+			}
+			lastKey[field.name] = key
+			m, _ := out[field.name].(map[string]int64)
+			if m == nil {
+				m = make(map[string]int64)
+				out[field.name] = m
+			}
+			m[key] = value
+		case field.typ == "string":
+			if !field.repeated {
+				out[field.name] = string(v)
+				break
+			}
+			list, _ := out[field.name].([]string)
+			out[field.name] = append(list, string(v))
+		case field.repeated:
+			// Packed scalars
+			var list []any
+			for len(v) > 0 {
+				x, n := protowire.ConsumeVarint(v)
+				if n < 0 {
+					t.Fatalf("%s.%s: %v", message, field.name, protowire.ParseError(n))
+				}
+				v = v[n:]
+				list = append(list, decodeScalar(t, field.typ, x))
+			}
+			out[field.name] = list
+		default:
+			out[field.name] = decodeProto(t, schema, field.typ, v)
+		}
+	}
+	return out
+}
+
+func TestMarshalProtoMatchesSchema(t *testing.T) {
+	schema := loadSchema(t)
+
+	board, err := game.NewBoard(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board.Cells[0][0] = game.X
+	board.Cells[1][1] = game.O
+	board.Cells[2][0] = game.X
+
+	tests := []struct {
+		name    string
+		message string
+		msg     protoMessage
+		want    map[string]any
+	}{
+		{"move request", "MoveRequest", moveRequest{Row: 2, Col: 14},
+			map[string]any{"row": int64(2), "col": int64(14)}},
+		{"status", "Status", statusMessage{Message: "Waiting for opponent"},
+			map[string]any{"message": "Waiting for opponent"}},
+		{"game over", "GameOver", gameOverMessage{
+			Message: "X wins", Reason: "line", Winner: "u1", Outcome: game.XWins,
+			Round: 2, BestOf: 3, SeriesScore: map[string]int{"u2": 0, "u1": 2},
+			SeriesOver: true, SeriesWinner: "u1",
+		}, map[string]any{
+			"message": "X wins", "reason": "line", "winner": "u1", "outcome": int64(game.XWins),
+			"round": int64(2), "best_of": int64(3), "series_score": map[string]int64{"u1": 2, "u2": 0},
+			"series_over": true, "series_winner": "u1",
+		}},
+		{"draw omits the winner", "GameOver", gameOverMessage{Message: "Draw", Reason: "draw", Outcome: game.Draw, Round: 1, BestOf: 1},
+			map[string]any{"message": "Draw", "reason": "draw", "outcome": int64(game.Draw), "round": int64(1), "best_of": int64(1)}},
+		{"move made", "MoveMade", moveMadeMessage{Row: 0, Col: 2, Mark: game.O, CurrentTurn: game.X},
+			map[string]any{"col": int64(2), "mark": int64(game.O), "current_turn": int64(game.X)}},
+		{"clock without a move clock", "Clock", clockMessage{
+			CurrentTurn: game.X, MoveRemainingMs: -1, Clocks: map[string]int64{"u2": 61000, "u1": 59250}, IncrementMs: 2000,
+		}, map[string]any{
+			"current_turn": int64(game.X), "move_remaining_ms": int64(-1),
+			"clocks": map[string]int64{"u1": 59250, "u2": 61000}, "increment_ms": int64(2000),
+		}},
+		{"clock with a move clock", "Clock", clockMessage{CurrentTurn: game.O, MoveRemainingMs: 29999},
+			map[string]any{"current_turn": int64(game.O), "move_remaining_ms": int64(29999)}},
+		{"disconnected", "Disconnected", disconnectedMessage{Message: "Player disconnected", UserID: "u2", SecondsRemaining: 27},
+			map[string]any{"message": "Player disconnected", "user_id": "u2", "seconds_remaining": int64(27)}},
+		{"reconnected", "Reconnected", reconnectedMessage{Message: "Player reconnected", UserID: "u2"},
+			map[string]any{"message": "Player reconnected", "user_id": "u2"}},
+		{"rematch", "RematchOffered", rematchMessage{Offers: []string{"u2", "u1"}, SecondsRemaining: 12},
+			map[string]any{"offers": []string{"u2", "u1"}, "seconds_remaining": int64(12)}},
+		{"closed", "MatchClosed", closedMessage{Message: "Server shutting down", Reason: "shutdown", SecondsRemaining: 5},
+			map[string]any{"message": "Server shutting down", "reason": "shutdown", "seconds_remaining": int64(5)}},
+		{"rejection", "Rejection", newRejection(OpCodeMove, errNotYourTurn),
+			map[string]any{"op_code": int64(OpCodeMove), "code": "not_your_turn", "message": errNotYourTurn.Error()}},
+		{"snapshot", "StateSnapshot", stateSnapshot{
+			ProtocolVersion: 2, Board: board, CurrentTurn: game.O, Players: map[string]game.Mark{"u1": game.X, "u2": game.O},
+			MatchState: MatchStateInProgress, BotMatch: true, MoveTimeMs: 30000, GameTimeMs: 300000, IncrementMs: 2000,
+			MoveRemainingMs: -1, Clocks: map[string]int64{"u1": 298000, "u2": 300000}, Disconnected: map[string]int64{"u2": 25},
+			Spectator: true, SpectatorCount: 4, BestOf: 3, Round: 2, SeriesScore: map[string]int{"u1": 1},
+			RematchOffers: []string{"u1"}, RematchSecondsRemaining: 9, BotLevel: 7,
+		}, map[string]any{
+			"protocol_version": int64(2),
+			"board": map[string]any{"size": int64(3), "win_length": int64(3), "cells": []any{
+				int64(game.X), int64(0), int64(0),
+				int64(0), int64(game.O), int64(0),
+				int64(game.X), int64(0), int64(0),
+			}},
+			"current_turn": int64(game.O), "players": map[string]int64{"u1": int64(game.X), "u2": int64(game.O)},
+			"match_state": int64(MatchStateInProgress), "bot_match": true,
+			"move_time_ms": int64(30000), "game_time_ms": int64(300000), "increment_ms": int64(2000),
+			"move_remaining_ms": int64(-1), "clocks": map[string]int64{"u1": 298000, "u2": 300000},
+			"disconnected": map[string]int64{"u2": 25}, "spectator": true, "spectator_count": int64(4),
+			"best_of": int64(3), "round": int64(2), "series_score": map[string]int64{"u1": 1},
+			"rematch_offers": []string{"u1"}, "rematch_seconds_remaining": int64(9), "bot_level": int64(7),
+		}},
+		{"zero values are omitted", "Clock", clockMessage{}, map[string]any{}},
+		{"zero move request", "MoveRequest", moveRequest{}, map[string]any{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.msg.marshalProto()
+			if got := decodeProto(t, schema, tt.message, b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %s = %v, want %v", tt.message, got, tt.want)
+			}
+			if again := tt.msg.marshalProto(); string(again) != string(b) {
+				t.Errorf("marshalProto is not deterministic")
+			}
+		})
+	}
+}
+
+func TestMarshalProtoLargeBoard(t *testing.T) {
+	schema := loadSchema(t)
+	board, err := game.NewBoard(game.MaxSize, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	board.Cells[game.MaxSize-1][game.MaxSize-1] = game.O
+	board.Cells[0][1] = game.X
+
+	got := decodeProto(t, schema, "StateSnapshot", stateSnapshot{Board: board}.marshalProto())
+	b, _ := got["board"].(map[string]any)
+	cells, _ := b["cells"].([]any)
+	if len(cells) != game.MaxSize*game.MaxSize {
+		t.Fatalf("board has %d cells, want %d", len(cells), game.MaxSize*game.MaxSize)
+	}
+	if cells[1] != int64(game.X) || cells[len(cells)-1] != int64(game.O) {
+		t.Errorf("cells are not row-major: first row %v, last cell %v", cells[:game.MaxSize], cells[len(cells)-1])
+	}
+}
+
+func TestMoveRequestUnmarshalProto(t *testing.T) {
+	var unknown []byte
+	unknown = protowire.AppendTag(unknown, 3, protowire.BytesType)
+	unknown = protowire.AppendString(unknown, "ignored")
+	unknown = protowire.AppendTag(unknown, 4, protowire.Fixed32Type)
+	unknown = protowire.AppendFixed32(unknown, 7)
+	unknown = append(unknown, moveRequest{Row: 1, Col: 2}.marshalProto()...)
+
+	var rowAsBytes []byte
+	rowAsBytes = protowire.AppendTag(rowAsBytes, 1, protowire.BytesType)
+	rowAsBytes = protowire.AppendString(rowAsBytes, "1")
+	rowAsBytes = append(rowAsBytes, moveRequest{Col: 2}.marshalProto()...)
+
+	tests := []struct {
+		name    string
+		b       []byte
+		want    moveRequest
+		wantErr bool
+	}{
+		{"round trip", moveRequest{Row: 14, Col: 3}.marshalProto(), moveRequest{Row: 14, Col: 3}, false},
+		{"negative coordinates", moveRequest{Row: -1, Col: -20}.marshalProto(), moveRequest{Row: -1, Col: -20}, false},
+		{"empty", nil, moveRequest{}, false},
+		{"unknown fields are skipped", unknown, moveRequest{Row: 1, Col: 2}, false},
+		{"wrong wire type is skipped", rowAsBytes, moveRequest{Col: 2}, false},
+		{"truncated tag", []byte{0x80}, moveRequest{}, true},
+		{"field number zero", []byte{0x00, 0x01}, moveRequest{}, true},
+		{"truncated varint", []byte{0x08, 0x80}, moveRequest{}, true},
+		{"truncated unknown bytes", []byte{0x1a, 0x05, 'a'}, moveRequest{}, true},
+		{"unmatched end group", []byte{0x0c}, moveRequest{}, true},
+		{"garbage after a valid field", append(moveRequest{Row: 1}.marshalProto(), 0xff), moveRequest{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := moveRequest{Row: 9, Col: 9}
+			err := r.unmarshalProto(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unmarshalProto(%x) error = %v, want error %v", tt.b, err, tt.wantErr)
+			}
+			if err == nil && r != tt.want {
+				t.Errorf("unmarshalProto(%x) = %+v, want %+v", tt.b, r, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	schema := loadSchema(t)
+	for _, name := range []string{"MoveRequest", "Status", "GameOver", "MoveMade", "Clock", "Disconnected",
+		"Reconnected", "Board", "StateSnapshot", "Rejection", "RematchOffered", "MatchClosed"} {
+		if len(schema[name]) == 0 {
+			t.Errorf("schema has no fields for %s", name)
+		}
+	}
+	if f := schema["StateSnapshot"][11]; f.name != "move_remaining_ms" || f.typ != "sint64" {
+		t.Errorf("StateSnapshot field 11 = %+v, want sint64 move_remaining_ms", f)
+	}
+}
@@ -0,0 +1,170 @@
+// Package game implements the Tic-Tac-Toe rules without any dependency on the
+// Nakama runtime, so the match handler, RPCs and offline tooling share them.
+package game
+
+import "errors"
+
+const (
+	// DefaultSize is the width and height of a classic board
+	DefaultSize = 3
+	// DefaultWinLength is the number of marks in a row needed on a classic board
+	DefaultWinLength = 3
+	// MinSize is the smallest supported board
+	MinSize = 3
+	// MaxSize is the largest supported board (gomoku)
+	MaxSize = 15
+)
+
+// Mark is the content of a single cell
+type Mark int
+
+const (
+	// Empty marks a free cell
+	Empty Mark = 0
+	// X always moves first
+	X Mark = 1
+	// O moves second
+	O Mark = 2
+)
+
+// Opponent returns the mark playing against m
+func (m Mark) Opponent() Mark {
+	switch m {
+	case X:
+		return O
+	case O:
+		return X
+	}
+	return Empty
+}
+
+// Move identifies a cell on the board
+type Move struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// Errors returned by board construction and move validation
+var (
+	ErrInvalidSize      = errors.New("invalid board size")
+	ErrInvalidWinLength = errors.New("invalid win length")
+	ErrOutOfBounds      = errors.New("out of bounds")
+	ErrCellOccupied     = errors.New("cell occupied")
+	ErrInvalidMark      = errors.New("invalid mark")
+)
+
+// Board is a Size x Size grid of marks won by WinLength marks in a row
+type Board struct {
+	Size      int      `json:"size"`
+	WinLength int      `json:"win_length"`
+	Cells     [][]Mark `json:"cells"`
+}
+
+// NewBoard returns an empty board for the given variant
+func NewBoard(size, winLength int) (Board, error) {
+	if size < MinSize || size > MaxSize {
+		return Board{}, ErrInvalidSize
+	}
+	if winLength < 3 || winLength > size {
+		return Board{}, ErrInvalidWinLength
+	}
+
+	cells := make([][]Mark, size)
+	for i := range cells {
+		cells[i] = make([]Mark, size)
+	}
+	return Board{Size: size, WinLength: winLength, Cells: cells}, nil
+}
+
+// DefaultWinLengthFor picks the usual win length for a board size: three on
+// classic boards, four on small boards and five (gomoku) beyond that
+func DefaultWinLengthFor(size int) int {
+	switch {
+	case size <= DefaultSize:
+		return DefaultWinLength
+	case size <= 6:
+		return 4
+	}
+	return 5
+}
+
+// IsClassic reports whether the board is plain 3x3 Tic-Tac-Toe
+func (b *Board) IsClassic() bool {
+	return b.Size == DefaultSize && b.WinLength == DefaultWinLength
+}
+
+// Clone returns a deep copy of the board
+func (b *Board) Clone() Board {
+	cells := make([][]Mark, len(b.Cells))
+	for i := range b.Cells {
+		cells[i] = append([]Mark(nil), b.Cells[i]...)
+	}
+	return Board{Size: b.Size, WinLength: b.WinLength, Cells: cells}
+}
+
+// InBounds reports whether the move lies on the board
+func (b *Board) InBounds(mv Move) bool {
+	return mv.Row >= 0 && mv.Row < b.Size && mv.Col >= 0 && mv.Col < b.Size
+}
+
+// At returns the mark in the given cell
+func (b *Board) At(mv Move) Mark {
+	return b.Cells[mv.Row][mv.Col]
+}
+
+// Validate checks that the move targets a free cell on the board
+func (b *Board) Validate(mv Move) error {
+	if !b.InBounds(mv) {
+		return ErrOutOfBounds
+	}
+	if b.Cells[mv.Row][mv.Col] != Empty {
+		return ErrCellOccupied
+	}
+	return nil
+}
+
+// Play validates the move and places mark on the board
+func (b *Board) Play(mv Move, mark Mark) error {
+	if mark != X && mark != O {
+		return ErrInvalidMark
+	}
+	if err := b.Validate(mv); err != nil {
+		return err
+	}
+	b.Cells[mv.Row][mv.Col] = mark
+	return nil
+}
+
+// LegalMoves returns every empty cell in row-major order
+func (b *Board) LegalMoves() []Move {
+	var moves []Move
+	for i := 0; i < b.Size; i++ {
+		for j := 0; j < b.Size; j++ {
+			if b.Cells[i][j] == Empty {
+				moves = append(moves, Move{Row: i, Col: j})
+			}
+		}
+	}
+	return moves
+}
+
+// Full reports whether no empty cells remain
+func (b *Board) Full() bool {
+	for i := 0; i < b.Size; i++ {
+		for j := 0; j < b.Size; j++ {
+			if b.Cells[i][j] == Empty {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// MoveFromIndex converts a row-major cell index into a move on a board of the
+// given size
+func MoveFromIndex(index, size int) (Move, error) {
+	if index < 0 || index >= size*size {
+		return Move{}, ErrOutOfBounds
+	}
+	return Move{Row: index / size, Col: index % size}, nil
+}
@@ -0,0 +1,247 @@
+package game
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// parseBoard builds a board from rows of 'X', 'O' and '.' characters
+func parseBoard(t *testing.T, winLength int, rows ...string) Board {
+	t.Helper()
+	b, err := NewBoard(len(rows), winLength)
+	if err != nil {
+		t.Fatalf("NewBoard(%d, %d): %v", len(rows), winLength, err)
+	}
+	for r, row := range rows {
+		if len(row) != len(rows) {
+			t.Fatalf("row %d has %d cells, want %d", r, len(row), len(rows))
+		}
+		for c, cell := range row {
+			switch cell {
+			case 'X':
+				b.Cells[r][c] = X
+			case 'O':
+				b.Cells[r][c] = O
+			case '.':
+			default:
+				t.Fatalf("unexpected cell %q", cell)
+			}
+		}
+	}
+	return b
+}
+
+func TestNewBoard(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		winLength int
+		err       error
+	}{
+		{"classic", 3, 3, nil},
+		{"smallest", MinSize, 3, nil},
+		{"largest", MaxSize, 5, nil},
+		{"win length equals size", 5, 5, nil},
+		{"too small", MinSize - 1, 3, ErrInvalidSize},
+		{"too large", MaxSize + 1, 5, ErrInvalidSize},
+		{"zero size", 0, 3, ErrInvalidSize},
+		{"win length too short", 5, 2, ErrInvalidWinLength},
+		{"win length longer than board", 4, 5, ErrInvalidWinLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBoard(tt.size, tt.winLength)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("NewBoard(%d, %d) error = %v, want %v", tt.size, tt.winLength, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if b.Size != tt.size || b.WinLength != tt.winLength || len(b.Cells) != tt.size {
+				t.Fatalf("NewBoard(%d, %d) = %dx%d win %d", tt.size, tt.winLength, len(b.Cells), b.Size, b.WinLength)
+			}
+			for _, row := range b.Cells {
+				if len(row) != tt.size {
+					t.Fatalf("row has %d cells, want %d", len(row), tt.size)
+				}
+				for _, cell := range row {
+					if cell != Empty {
+						t.Fatalf("new board has mark %d", cell)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDefaultWinLengthFor(t *testing.T) {
+	tests := []struct {
+		size, want int
+	}{
+		{3, 3}, {4, 4}, {6, 4}, {7, 5}, {15, 5},
+	}
+	for _, tt := range tests {
+		if got := DefaultWinLengthFor(tt.size); got != tt.want {
+			t.Errorf("DefaultWinLengthFor(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	b := parseBoard(t, 3,
+		"X..",
+		".O.",
+		"...",
+	)
+	tests := []struct {
+		name string
+		mv   Move
+		err  error
+	}{
+		{"empty cell", Move{Row: 0, Col: 1}, nil},
+		{"far corner", Move{Row: 2, Col: 2}, nil},
+		{"occupied by X", Move{Row: 0, Col: 0}, ErrCellOccupied},
+		{"occupied by O", Move{Row: 1, Col: 1}, ErrCellOccupied},
+		{"negative row", Move{Row: -1, Col: 0}, ErrOutOfBounds},
+		{"negative col", Move{Row: 0, Col: -1}, ErrOutOfBounds},
+		{"row past edge", Move{Row: 3, Col: 0}, ErrOutOfBounds},
+		{"col past edge", Move{Row: 0, Col: 3}, ErrOutOfBounds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := b.Validate(tt.mv); !errors.Is(err, tt.err) {
+				t.Fatalf("Validate(%+v) = %v, want %v", tt.mv, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPlay(t *testing.T) {
+	tests := []struct {
+		name string
+		mv   Move
+		mark Mark
+		err  error
+	}{
+		{"X on empty cell", Move{Row: 0, Col: 1}, X, nil},
+		{"O on empty cell", Move{Row: 2, Col: 2}, O, nil},
+		{"empty mark", Move{Row: 0, Col: 1}, Empty, ErrInvalidMark},
+		{"unknown mark", Move{Row: 0, Col: 1}, Mark(3), ErrInvalidMark},
+		{"occupied cell", Move{Row: 0, Col: 0}, O, ErrCellOccupied},
+		{"out of bounds", Move{Row: 5, Col: 5}, X, ErrOutOfBounds},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := parseBoard(t, 3,
+				"X..",
+				"...",
+				"...",
+			)
+			before := b.Clone()
+			err := b.Play(tt.mv, tt.mark)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Play(%+v, %d) = %v, want %v", tt.mv, tt.mark, err, tt.err)
+			}
+			if err != nil {
+				if !reflect.DeepEqual(b, before) {
+					t.Fatalf("rejected move changed the board")
+				}
+				return
+			}
+			if got := b.At(tt.mv); got != tt.mark {
+				t.Fatalf("cell holds %d after Play, want %d", got, tt.mark)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	b := parseBoard(t, 3,
+		"X..",
+		"...",
+		"...",
+	)
+	c := b.Clone()
+	c.Cells[1][1] = O
+	if b.Cells[1][1] != Empty {
+		t.Fatal("modifying the clone changed the original")
+	}
+}
+
+func TestLegalMovesAndFull(t *testing.T) {
+	tests := []struct {
+		name  string
+		board []string
+		moves []Move
+		full  bool
+	}{
+		{
+			name:  "empty",
+			board: []string{"...", "...", "..."},
+			moves: []Move{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}, {2, 0}, {2, 1}, {2, 2}},
+		},
+		{
+			name:  "partly filled in row-major order",
+			board: []string{"XO.", ".X.", "O.."},
+			moves: []Move{{0, 2}, {1, 0}, {1, 2}, {2, 1}, {2, 2}},
+		},
+		{
+			name:  "one cell left",
+			board: []string{"XOX", "XOO", "OX."},
+			moves: []Move{{2, 2}},
+		},
+		{
+			name:  "full",
+			board: []string{"XOX", "XOO", "OXX"},
+			full:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := parseBoard(t, 3, tt.board...)
+			if got := b.LegalMoves(); !reflect.DeepEqual(got, tt.moves) {
+				t.Errorf("LegalMoves() = %v, want %v", got, tt.moves)
+			}
+			if got := b.Full(); got != tt.full {
+				t.Errorf("Full() = %v, want %v", got, tt.full)
+			}
+		})
+	}
+}
+
+func TestMoveFromIndex(t *testing.T) {
+	tests := []struct {
+		index, size int
+		want        Move
+		err         error
+	}{
+		{0, 3, Move{Row: 0, Col: 0}, nil},
+		{4, 3, Move{Row: 1, Col: 1}, nil},
+		{8, 3, Move{Row: 2, Col: 2}, nil},
+		{7, 5, Move{Row: 1, Col: 2}, nil},
+		{224, 15, Move{Row: 14, Col: 14}, nil},
+		{-1, 3, Move{}, ErrOutOfBounds},
+		{9, 3, Move{}, ErrOutOfBounds},
+		{225, 15, Move{}, ErrOutOfBounds},
+	}
+	for _, tt := range tests {
+		got, err := MoveFromIndex(tt.index, tt.size)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("MoveFromIndex(%d, %d) = %+v, %v, want %+v, %v", tt.index, tt.size, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestOpponent(t *testing.T) {
+	tests := []struct {
+		mark, want Mark
+	}{
+		{X, O}, {O, X}, {Empty, Empty},
+	}
+	for _, tt := range tests {
+		if got := tt.mark.Opponent(); got != tt.want {
+			t.Errorf("%d.Opponent() = %d, want %d", tt.mark, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package game
+
+// BestMove returns the optimal move for mark using a full-depth minimax search.
+// The search is exhaustive, so it is only practical on the classic 3x3 board.
+// ok is false when the board has no legal moves.
+func BestMove(board Board, mark Mark) (mv Move, ok bool) {
+	b := board.Clone()
+	bestScore := -1000
+	for _, candidate := range b.LegalMoves() {
+		b.Cells[candidate.Row][candidate.Col] = mark
+		score := minimax(&b, 0, false, mark, mark.Opponent())
+		b.Cells[candidate.Row][candidate.Col] = Empty
+
+		if !ok || score > bestScore {
+			bestScore = score
+			mv = candidate
+			ok = true
+		}
+	}
+	return mv, ok
+}
+
+// minimax scores the board from the perspective of self, preferring quicker wins
+// and slower losses
+func minimax(b *Board, depth int, isMaximizing bool, self Mark, opponent Mark) int {
+	if b.HasWon(self) {
+		return 10 - depth
+	}
+	if b.HasWon(opponent) {
+		return depth - 10
+	}
+	if b.Full() {
+		return 0
+	}
+
+	if isMaximizing {
+		bestScore := -1000
+		for _, mv := range b.LegalMoves() {
+			b.Cells[mv.Row][mv.Col] = self
+			score := minimax(b, depth+1, false, self, opponent)
+			b.Cells[mv.Row][mv.Col] = Empty
+			if score > bestScore {
+				bestScore = score
+			}
+		}
+		return bestScore
+	}
+
+	bestScore := 1000
+	for _, mv := range b.LegalMoves() {
+		b.Cells[mv.Row][mv.Col] = opponent
+		score := minimax(b, depth+1, true, self, opponent)
+		b.Cells[mv.Row][mv.Col] = Empty
+		if score < bestScore {
+			bestScore = score
+		}
+	}
+	return bestScore
+}
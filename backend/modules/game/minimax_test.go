@@ -0,0 +1,60 @@
+package game
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBestMove(t *testing.T) {
+	tests := []struct {
+		name  string
+		mark  Mark
+		board []string
+		want  []Move // any of these is optimal
+	}{
+		{"takes the win", X, []string{"XX.", "OO.", "..."}, []Move{{0, 2}}},
+		{"prefers winning to blocking", O, []string{"XX.", "OO.", "X.."}, []Move{{1, 2}}},
+		{"blocks the row", O, []string{"XX.", ".O.", "..."}, []Move{{0, 2}}},
+		{"blocks the column", X, []string{"O.X", "O..", "..."}, []Move{{2, 0}}},
+		{"blocks the anti-diagonal", X, []string{"X.O", ".O.", "..X"}, []Move{{2, 0}}},
+		{"answers a corner with the centre", O, []string{"X..", "...", "..."}, []Move{{1, 1}}},
+		{"fills the last cell", X, []string{"XOX", "XOO", "OX."}, []Move{{2, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := parseBoard(t, 3, tt.board...)
+			mv, ok := BestMove(b, tt.mark)
+			if !ok {
+				t.Fatal("BestMove found no move")
+			}
+			if !slices.Contains(tt.want, mv) {
+				t.Fatalf("BestMove = %+v, want one of %v", mv, tt.want)
+			}
+		})
+	}
+}
+
+func TestBestMoveFullBoard(t *testing.T) {
+	b := parseBoard(t, 3, "XOX", "XOO", "OXX")
+	if mv, ok := BestMove(b, O); ok {
+		t.Fatalf("BestMove on a full board = %+v, want none", mv)
+	}
+}
+
+func TestBestMoveSelfPlayDraws(t *testing.T) {
+	b := parseBoard(t, 3, "...", "...", "...")
+	mark := X
+	for !b.Outcome().Finished() {
+		mv, ok := BestMove(b, mark)
+		if !ok {
+			t.Fatal("BestMove found no move before the game ended")
+		}
+		if err := b.Play(mv, mark); err != nil {
+			t.Fatalf("BestMove chose an illegal move %+v: %v", mv, err)
+		}
+		mark = mark.Opponent()
+	}
+	if got := b.Outcome(); got != Draw {
+		t.Fatalf("perfect play ended in %d, want a draw", got)
+	}
+}
@@ -0,0 +1,117 @@
+package game
+
+// Outcome is the result of evaluating a board
+type Outcome int
+
+const (
+	// InProgress means the game has not finished yet
+	InProgress Outcome = 0
+	// XWins means X completed a line
+	XWins Outcome = 1
+	// OWins means O completed a line
+	OWins Outcome = 2
+	// Draw means the board filled up without a winner
+	Draw Outcome = 3
+)
+
+// WinFor returns the winning outcome for mark
+func WinFor(mark Mark) Outcome {
+	switch mark {
+	case X:
+		return XWins
+	case O:
+		return OWins
+	}
+	return InProgress
+}
+
+// Winner returns the winning mark, or Empty for draws and unfinished games
+func (o Outcome) Winner() Mark {
+	switch o {
+	case XWins:
+		return X
+	case OWins:
+		return O
+	}
+	return Empty
+}
+
+// Finished reports whether the outcome ends the game
+func (o Outcome) Finished() bool {
+	return o != InProgress
+}
+
+// directions are the four line orientations: horizontal, vertical, diagonal
+// and anti-diagonal
+var directions = [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+
+// WinsAt reports whether the mark at mv completes WinLength in a row through
+// that cell
+func (b *Board) WinsAt(mv Move) bool {
+	if !b.InBounds(mv) {
+		return false
+	}
+	mark := b.Cells[mv.Row][mv.Col]
+	if mark == Empty {
+		return false
+	}
+
+	for _, d := range directions {
+		count := 1 + b.run(mv, d[0], d[1], mark) + b.run(mv, -d[0], -d[1], mark)
+		if count >= b.WinLength {
+			return true
+		}
+	}
+	return false
+}
+
+// run counts consecutive cells holding mark starting next to mv and walking in
+// the direction (dr, dc)
+func (b *Board) run(mv Move, dr, dc int, mark Mark) int {
+	count := 0
+	r, c := mv.Row+dr, mv.Col+dc
+	for r >= 0 && r < b.Size && c >= 0 && c < b.Size && b.Cells[r][c] == mark {
+		count++
+		r += dr
+		c += dc
+	}
+	return count
+}
+
+// HasWon reports whether mark has completed any line
+func (b *Board) HasWon(mark Mark) bool {
+	for i := 0; i < b.Size; i++ {
+		for j := 0; j < b.Size; j++ {
+			if b.Cells[i][j] == mark && b.WinsAt(Move{Row: i, Col: j}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Outcome evaluates the whole board
+func (b *Board) Outcome() Outcome {
+	if b.HasWon(X) {
+		return XWins
+	}
+	if b.HasWon(O) {
+		return OWins
+	}
+	if b.Full() {
+		return Draw
+	}
+	return InProgress
+}
+
+// OutcomeAfter evaluates the board after mv was played; it only inspects lines
+// through mv, which is all that can change with a single move
+func (b *Board) OutcomeAfter(mv Move) Outcome {
+	if b.WinsAt(mv) {
+		return WinFor(b.At(mv))
+	}
+	if b.Full() {
+		return Draw
+	}
+	return InProgress
+}
@@ -0,0 +1,114 @@
+package game
+
+import (
+	"strings"
+	"testing"
+)
+
+// emptyRows returns n rows of n empty cells
+func emptyRows(n int) []string {
+	rows := make([]string, n)
+	for i := range rows {
+		rows[i] = strings.Repeat(".", n)
+	}
+	return rows
+}
+
+// withMarks returns rows with mark placed on each move
+func withMarks(rows []string, mark byte, moves ...Move) []string {
+	out := append([]string(nil), rows...)
+	for _, mv := range moves {
+		row := []byte(out[mv.Row])
+		row[mv.Col] = mark
+		out[mv.Row] = string(row)
+	}
+	return out
+}
+
+// line returns length moves starting at (row, col) and stepping by (dr, dc)
+func line(row, col, dr, dc, length int) []Move {
+	moves := make([]Move, length)
+	for i := range moves {
+		moves[i] = Move{Row: row + i*dr, Col: col + i*dc}
+	}
+	return moves
+}
+
+func TestWinsAtAndOutcomeAfter(t *testing.T) {
+	tests := []struct {
+		name      string
+		winLength int
+		rows      []string
+		last      Move
+		wins      bool
+		outcome   Outcome
+	}{
+		// Classic board, each direction
+		{"3x3 row", 3, []string{"XXX", "OO.", "..."}, Move{0, 1}, true, XWins},
+		{"3x3 column", 3, []string{"OX.", "OX.", "O.X"}, Move{2, 0}, true, OWins},
+		{"3x3 diagonal", 3, []string{"XO.", "OX.", "..X"}, Move{2, 2}, true, XWins},
+		{"3x3 anti-diagonal", 3, []string{"X.O", "XO.", "OX."}, Move{0, 2}, true, OWins},
+		{"3x3 no line", 3, []string{"XO.", "...", "..."}, Move{0, 0}, false, InProgress},
+		{"3x3 full draw", 3, []string{"XOX", "XOO", "OXX"}, Move{2, 2}, false, Draw},
+		{"3x3 win on last cell", 3, []string{"XOX", "OXO", "OXX"}, Move{2, 2}, true, XWins},
+		{"out of bounds", 3, []string{"XXX", "...", "..."}, Move{3, 0}, false, InProgress},
+		{"empty cell", 3, []string{"XX.", "...", "..."}, Move{0, 2}, false, InProgress},
+
+		// 5x5 four in a row, each direction and away from the edges
+		{"5x5 k4 row", 4, withMarks(emptyRows(5), 'X', line(2, 1, 0, 1, 4)...), Move{2, 3}, true, XWins},
+		{"5x5 k4 column", 4, withMarks(emptyRows(5), 'O', line(0, 4, 1, 0, 4)...), Move{0, 4}, true, OWins},
+		{"5x5 k4 diagonal", 4, withMarks(emptyRows(5), 'X', line(1, 1, 1, 1, 4)...), Move{3, 3}, true, XWins},
+		{"5x5 k4 anti-diagonal", 4, withMarks(emptyRows(5), 'O', line(0, 4, 1, -1, 4)...), Move{2, 2}, true, OWins},
+		{"5x5 k4 three only", 4, withMarks(emptyRows(5), 'X', line(2, 0, 0, 1, 3)...), Move{2, 2}, false, InProgress},
+		{"5x5 k4 broken line", 4, withMarks(withMarks(emptyRows(5), 'X', Move{0, 0}, Move{0, 1}, Move{0, 3}, Move{0, 4}), 'O', Move{0, 2}), Move{0, 1}, false, InProgress},
+
+		// 15x15 gomoku, each direction and at the far edges
+		{"15x15 k5 row", 5, withMarks(emptyRows(15), 'X', line(14, 10, 0, 1, 5)...), Move{14, 12}, true, XWins},
+		{"15x15 k5 column", 5, withMarks(emptyRows(15), 'O', line(3, 7, 1, 0, 5)...), Move{3, 7}, true, OWins},
+		{"15x15 k5 diagonal", 5, withMarks(emptyRows(15), 'X', line(10, 10, 1, 1, 5)...), Move{14, 14}, true, XWins},
+		{"15x15 k5 anti-diagonal", 5, withMarks(emptyRows(15), 'O', line(0, 14, 1, -1, 5)...), Move{4, 10}, true, OWins},
+		{"15x15 k5 four only", 5, withMarks(emptyRows(15), 'X', line(7, 3, 1, 1, 4)...), Move{8, 4}, false, InProgress},
+		{"15x15 k5 overline", 5, withMarks(emptyRows(15), 'X', line(7, 0, 0, 1, 6)...), Move{7, 5}, true, XWins},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := parseBoard(t, tt.winLength, tt.rows...)
+			if got := b.WinsAt(tt.last); got != tt.wins {
+				t.Errorf("WinsAt(%+v) = %v, want %v", tt.last, got, tt.wins)
+			}
+			if !b.InBounds(tt.last) {
+				return
+			}
+			if got := b.OutcomeAfter(tt.last); got != tt.outcome {
+				t.Errorf("OutcomeAfter(%+v) = %d, want %d", tt.last, got, tt.outcome)
+			}
+			if got := b.Outcome(); got != tt.outcome {
+				t.Errorf("Outcome() = %d, want %d", got, tt.outcome)
+			}
+		})
+	}
+}
+
+func TestOutcomeHelpers(t *testing.T) {
+	tests := []struct {
+		outcome  Outcome
+		winner   Mark
+		finished bool
+	}{
+		{InProgress, Empty, false},
+		{XWins, X, true},
+		{OWins, O, true},
+		{Draw, Empty, true},
+	}
+	for _, tt := range tests {
+		if got := tt.outcome.Winner(); got != tt.winner {
+			t.Errorf("Outcome(%d).Winner() = %d, want %d", tt.outcome, got, tt.winner)
+		}
+		if got := tt.outcome.Finished(); got != tt.finished {
+			t.Errorf("Outcome(%d).Finished() = %v, want %v", tt.outcome, got, tt.finished)
+		}
+	}
+	if WinFor(X) != XWins || WinFor(O) != OWins || WinFor(Empty) != InProgress {
+		t.Error("WinFor does not map marks to their wins")
+	}
+}
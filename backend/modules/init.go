@@ -11,6 +11,15 @@ import (
 func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, initializer runtime.Initializer) error {
 	logger.Info("Initializing Nakama Arena game module")
 
+	if err := createLeaderboards(ctx, nk); err != nil {
+		logger.Error("Unable to create leaderboards: %v", err)
+		return err
+	}
+	if err := backfillLeaderboards(ctx, logger, db, nk); err != nil {
+		logger.Error("Unable to backfill leaderboards: %v", err)
+		return err
+	}
+
 	// Register RPC functions
 	if err := initializer.RegisterRpc("register_player", registerPlayer); err != nil {
 		logger.Error("Unable to register RPC function: %v", err)
@@ -27,6 +36,11 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return err
 	}
 
+	if err := initializer.RegisterRpc("get_bot_stats", getBotStats); err != nil {
+		logger.Error("Unable to register RPC function get_bot_stats: %v", err)
+		return err
+	}
+
 	if err := initializer.RegisterRpc("request_verification", requestVerification); err != nil {
 		logger.Error("Unable to register RPC function request_verification: %v", err)
 		return err
@@ -47,6 +61,11 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return err
 	}
 
+	if err := initializer.RegisterRpc("abort_match", rpcAbortMatch); err != nil {
+		logger.Error("Unable to register RPC: %v", err)
+		return err
+	}
+
 	if err := initializer.RegisterRpc("list_rooms", rpcListRooms); err != nil {
 		logger.Error("Unable to register RPC: %v", err)
 		return err
@@ -57,17 +76,56 @@ func InitModule(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runti
 		return err
 	}
 
+	if err := initializer.RegisterRpc("create_bot_match", rpcCreateBotMatch); err != nil {
+		logger.Error("Unable to register RPC: %v", err)
+		return err
+	}
+
 	if err := initializer.RegisterRpc("join_room", rpcJoinRoom); err != nil {
 		logger.Error("Unable to register RPC: %v", err)
 		return err
 	}
 
+	if err := initializer.RegisterRpc("analyze_position", rpcAnalyzePosition); err != nil {
+		logger.Error("Unable to register RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("matchmaking_ticket", rpcMatchmakingTicket); err != nil {
+		logger.Error("Unable to register RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterBeforeRt("MatchmakerAdd", beforeMatchmakerAdd); err != nil {
+		logger.Error("Unable to register matchmaker add hook: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterMatchmakerMatched(matchmakerMatched); err != nil {
+		logger.Error("Unable to register matchmaker matched hook: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("get_season", rpcGetSeason); err != nil {
+		logger.Error("Unable to register RPC: %v", err)
+		return err
+	}
+
+	if err := initializer.RegisterRpc("get_season_standings", rpcGetSeasonStandings); err != nil {
+		logger.Error("Unable to register RPC: %v", err)
+		return err
+	}
+
 	// Register match handler for our game
     if err := initializer.RegisterMatch("tic_tac_toe", createTicTacToeMatch); err != nil {
 		logger.Error("Unable to register match handler: %v", err)
 		return err
 	}
 
+	// End seasons on schedule; every node runs the check and the first to
+	// lock an expired season ends it
+	go runSeasonScheduler(context.Background(), logger, db, nk)
+
 	logger.Info("Nakama Arena game module initialized successfully")
 	return nil
 }
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/heroiclabs/nakama-common/api"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/rating"
+)
+
+// Nakama leaderboards the match results are written to
+const (
+	// LeaderboardRating ranks the current season by conservative rating
+	LeaderboardRating = "arena_rating"
+	// LeaderboardAllTime, LeaderboardWeekly and LeaderboardDaily rank players by
+	// points won over their period
+	LeaderboardAllTime = "arena_all_time"
+	LeaderboardWeekly  = "arena_weekly"
+	LeaderboardDaily   = "arena_daily"
+)
+
+const (
+	// LeaderboardWinPoints and LeaderboardDrawPoints are added to the periodic
+	// boards for each rated series
+	LeaderboardWinPoints  = 2
+	LeaderboardDrawPoints = 1
+
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+	// maxFriends is the most friends a friends-only leaderboard considers
+	maxFriends = 1000
+)
+
+// leaderboardConfig describes one of our Nakama leaderboards
+type leaderboardConfig struct {
+	ID            string
+	Operator      string
+	ResetSchedule string // cron expression, empty for boards that never reset
+}
+
+// leaderboards maps the board names get_leaderboard accepts to their config.
+// The rating board is reset when a season ends rather than on a schedule.
+var leaderboards = map[string]leaderboardConfig{
+	"rating":   {ID: LeaderboardRating, Operator: "set"},
+	"all_time": {ID: LeaderboardAllTime, Operator: "incr"},
+	"weekly":   {ID: LeaderboardWeekly, Operator: "incr", ResetSchedule: "0 0 * * 1"},
+	"daily":    {ID: LeaderboardDaily, Operator: "incr", ResetSchedule: "0 0 * * *"},
+}
+
+// createLeaderboards creates any of our leaderboards that do not exist yet
+func createLeaderboards(ctx context.Context, nk runtime.NakamaModule) error {
+	for _, config := range leaderboards {
+		if err := nk.LeaderboardCreate(ctx, config.ID, true, "desc", config.Operator, config.ResetSchedule, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetRatingLeaderboard empties the rating board for a new season
+func resetRatingLeaderboard(ctx context.Context, nk runtime.NakamaModule) error {
+	if err := nk.LeaderboardDelete(ctx, LeaderboardRating); err != nil {
+		return err
+	}
+	config := leaderboards["rating"]
+	return nk.LeaderboardCreate(ctx, config.ID, true, "desc", config.Operator, config.ResetSchedule, nil)
+}
+
+// writeLeaderboards records rated players on every leaderboard. The rating
+// board holds the conservative rating with the rating itself breaking ties.
+func writeLeaderboards(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, players []ratedPlayer) {
+	for _, p := range players {
+		if err := writeRatingRecord(ctx, nk, p); err != nil {
+			logger.Error("Error writing %s leaderboard record: %v", LeaderboardRating, err)
+		}
+
+		var points int64
+		switch p.Result {
+		case rating.Win:
+			points = LeaderboardWinPoints
+		case rating.Draw:
+			points = LeaderboardDrawPoints
+		}
+		for _, id := range []string{LeaderboardAllTime, LeaderboardWeekly, LeaderboardDaily} {
+			if _, err := nk.LeaderboardRecordWrite(ctx, id, p.UserID, p.Username, points, 0, nil, nil); err != nil {
+				logger.Error("Error writing %s leaderboard record: %v", id, err)
+			}
+		}
+	}
+}
+
+// writeRatingRecord sets the player's record on the rating board
+func writeRatingRecord(ctx context.Context, nk runtime.NakamaModule, p ratedPlayer) error {
+	metadata := map[string]interface{}{
+		"rating":    p.Rating.Rating,
+		"deviation": p.Rating.Deviation,
+		"wins":      p.Wins,
+		"losses":    p.Losses,
+		"draws":     p.Draws,
+	}
+	score, subscore := int64(math.Round(p.Rating.Conservative())), int64(math.Round(p.Rating.Rating))
+	_, err := nk.LeaderboardRecordWrite(ctx, LeaderboardRating, p.UserID, p.Username, score, subscore, metadata, nil)
+	return err
+}
+
+// backfillLeaderboards copies players recorded before the Nakama leaderboards
+// existed onto them: their rating if they have played this season and the
+// points their all-time record is worth. Each row is marked once copied so
+// restarts do not add the points again.
+func backfillLeaderboards(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, username, wins, draws, rating, rating_deviation, rating_volatility, season_wins, season_losses, season_draws
+		FROM player_stats
+		WHERE leaderboards_backfilled IS NOT TRUE
+	`)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		player ratedPlayer // season record in Wins, Losses and Draws
+		wins   int         // all-time
+		draws  int
+	}
+	var players []pending
+	for rows.Next() {
+		var p pending
+		r := &p.player.Rating
+		if err := rows.Scan(&p.player.UserID, &p.player.Username, &p.wins, &p.draws, &r.Rating, &r.Deviation, &r.Volatility, &p.player.Wins, &p.player.Losses, &p.player.Draws); err != nil {
+			rows.Close()
+			return err
+		}
+		players = append(players, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range players {
+		if p.player.Wins+p.player.Losses+p.player.Draws > 0 {
+			if err := writeRatingRecord(ctx, nk, p.player); err != nil {
+				return err
+			}
+		}
+		if points := int64(p.wins*LeaderboardWinPoints + p.draws*LeaderboardDrawPoints); points > 0 {
+			if _, err := nk.LeaderboardRecordWrite(ctx, LeaderboardAllTime, p.player.UserID, p.player.Username, points, 0, nil, nil); err != nil {
+				return err
+			}
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE player_stats SET leaderboards_backfilled = TRUE WHERE user_id = $1`, p.player.UserID); err != nil {
+			return err
+		}
+	}
+	if len(players) > 0 {
+		logger.Info("Backfilled %d players onto the leaderboards", len(players))
+	}
+	return nil
+}
+
+// playerRank returns userID's rank on the rating board, 0 if unranked
+func playerRank(ctx context.Context, nk runtime.NakamaModule, userID string) (int64, error) {
+	_, records, _, _, err := nk.LeaderboardRecordsList(ctx, LeaderboardRating, []string{userID}, 1, "", 0)
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	return records[0].Rank, nil
+}
+
+// leaderboardEntry flattens a record and its metadata for clients
+func leaderboardEntry(record *api.LeaderboardRecord) map[string]interface{} {
+	entry := make(map[string]interface{})
+	if record.Metadata != "" {
+		_ = json.Unmarshal([]byte(record.Metadata), &entry)
+	}
+	entry["user_id"] = record.OwnerId
+	entry["username"] = record.Username.GetValue()
+	entry["score"] = record.Score
+	entry["subscore"] = record.Subscore
+	entry["rank"] = record.Rank
+	return entry
+}
+
+// getLeaderboard returns a page of one of our leaderboards: the top players,
+// the players around the caller, or the caller and their friends
+func getLeaderboard(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var input struct {
+		Board    string `json:"board"`
+		Limit    int    `json:"limit"`
+		Cursor   string `json:"cursor"`
+		AroundMe bool   `json:"around_me"`
+		Friends  bool   `json:"friends"`
+	}
+
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			return "", runtime.NewError("Invalid payload", 400)
+		}
+	}
+
+	if input.Board == "" {
+		input.Board = "rating"
+	}
+	config, ok := leaderboards[input.Board]
+	if !ok {
+		return "", runtime.NewError("board must be rating, all_time, weekly or daily", 400)
+	}
+	if input.Limit <= 0 {
+		input.Limit = defaultLeaderboardLimit
+	}
+	input.Limit = min(input.Limit, maxLeaderboardLimit)
+
+	userID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if (input.AroundMe || input.Friends) && userID == "" {
+		return "", runtime.NewError("User ID not found", 401)
+	}
+
+	var records []*api.LeaderboardRecord
+	var nextCursor, prevCursor string
+	switch {
+	case input.Friends:
+		// Friends-only boards hold every mutual friend, so they are not paged
+		friendState := 0
+		friends, _, err := nk.FriendsList(ctx, userID, maxFriends, &friendState, "")
+		if err != nil {
+			logger.Error("Error listing friends: %v", err)
+			return "", runtime.NewError("Error retrieving leaderboard", 500)
+		}
+		ownerIDs := []string{userID}
+		for _, friend := range friends {
+			ownerIDs = append(ownerIDs, friend.GetUser().GetId())
+		}
+		_, records, _, _, err = nk.LeaderboardRecordsList(ctx, config.ID, ownerIDs, 1, "", 0)
+		if err != nil {
+			logger.Error("Error querying leaderboard: %v", err)
+			return "", runtime.NewError("Error retrieving leaderboard", 500)
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].Rank < records[j].Rank })
+
+	case input.AroundMe:
+		list, err := nk.LeaderboardRecordsHaystack(ctx, config.ID, userID, input.Limit, input.Cursor, 0)
+		if err != nil {
+			logger.Error("Error querying leaderboard: %v", err)
+			return "", runtime.NewError("Error retrieving leaderboard", 500)
+		}
+		records, nextCursor, prevCursor = list.Records, list.NextCursor, list.PrevCursor
+
+	default:
+		var err error
+		records, _, nextCursor, prevCursor, err = nk.LeaderboardRecordsList(ctx, config.ID, nil, input.Limit, input.Cursor, 0)
+		if err != nil {
+			logger.Error("Error querying leaderboard: %v", err)
+			return "", runtime.NewError("Error retrieving leaderboard", 500)
+		}
+	}
+
+	leaderboard := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		leaderboard = append(leaderboard, leaderboardEntry(record))
+	}
+
+	result := map[string]interface{}{
+		"board":       input.Board,
+		"leaderboard": leaderboard,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	}
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error marshaling result: %v", err)
+		return "", runtime.NewError("Error processing leaderboard", 500)
+	}
+	return string(jsonResult), nil
+}
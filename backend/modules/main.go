@@ -13,6 +13,10 @@ import (
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/bot"
+	"nakama-arena/modules/game"
+	"nakama-arena/modules/rating"
 )
 
 // nk represents the Nakama server instance
@@ -70,18 +74,25 @@ func registerPlayer(ctx context.Context, logger runtime.Logger, db *sql.DB, nk r
 		VALUES ($1, $2)
 		ON CONFLICT (user_id) DO UPDATE
 		SET username = $2, updated_at = NOW()
-		RETURNING user_id, username, score, wins, losses, draws, rank
+		RETURNING user_id, username, score, wins, losses, draws, rating, rating_deviation
 	`
 
 	var dbUserID, dbUsername string
-	var score, wins, losses, draws, rank int
+	var score, wins, losses, draws int
+	var r rating.Rating
 
-	err := db.QueryRowContext(ctx, query, userID, username).Scan(&dbUserID, &dbUsername, &score, &wins, &losses, &draws, &rank)
+	err := db.QueryRowContext(ctx, query, userID, username).Scan(&dbUserID, &dbUsername, &score, &wins, &losses, &draws, &r.Rating, &r.Deviation)
 	if err != nil {
 		logger.Error("Error registering player: %v", err)
 		return "", runtime.NewError("Error registering player", 500)
 	}
 
+	// Ranks are kept by the rating leaderboard
+	rank, err := playerRank(ctx, nk, userID)
+	if err != nil {
+		logger.Warn("Error reading player rank: %v", err)
+	}
+
 	// Return player stats as JSON
 	result := map[string]interface{}{
 		"user_id":  dbUserID,
@@ -91,6 +102,8 @@ func registerPlayer(ctx context.Context, logger runtime.Logger, db *sql.DB, nk r
 		"losses":   losses,
 		"draws":    draws,
 		"rank":     rank,
+		"rating":    r.Rating,
+		"deviation": r.Deviation,
 	}
 
 	jsonResult, err := json.Marshal(result)
@@ -102,75 +115,75 @@ func registerPlayer(ctx context.Context, logger runtime.Logger, db *sql.DB, nk r
 	return string(jsonResult), nil
 }
 
-// updatePlayerStats updates a player's stats after a match
+// updatePlayerStats corrects a player's record by one game. Only server-to-server
+// calls made with the http_key may use it; players' stats otherwise change
+// only when the match handler records a result. Every correction is audited.
 func updatePlayerStats(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	// Client sessions always carry a user ID; http_key calls do not
+	if callerID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); callerID != "" {
+		logger.Warn("User %s called update_player_stats", callerID)
+		return "", runtime.NewError("update_player_stats is only available to the server", 403)
+	}
+
 	// Parse payload
 	var input struct {
 		UserID string `json:"user_id"`
 		Win    bool   `json:"win"`
 		Draw   bool   `json:"draw"`
-		Score  int    `json:"score"`
+		Reason string `json:"reason"`
 	}
 
 	if err := json.Unmarshal([]byte(payload), &input); err != nil {
 		logger.Error("Error parsing payload: %v", err)
 		return "", runtime.NewError("Invalid payload", 400)
 	}
+	if input.UserID == "" || strings.TrimSpace(input.Reason) == "" {
+		return "", runtime.NewError("user_id and reason are required", 400)
+	}
 
-	// Update player stats based on match result
-	var query string
-	var args []interface{}
-
+	// Pick the record to correct; ratings and score are only changed by matches
+	column := "losses"
 	if input.Draw {
-		query = `
-			UPDATE player_stats
-			SET draws = draws + 1, score = score + $2, updated_at = NOW()
-			WHERE user_id = $1
-			RETURNING user_id, username, score, wins, losses, draws, rank
-		`
-		args = []interface{}{input.UserID, input.Score}
+		column = "draws"
 	} else if input.Win {
-		query = `
-			UPDATE player_stats
-			SET wins = wins + 1, score = score + $2, updated_at = NOW()
-			WHERE user_id = $1
-			RETURNING user_id, username, score, wins, losses, draws, rank
-		`
-		args = []interface{}{input.UserID, input.Score}
-	} else {
-		query = `
-			UPDATE player_stats
-			SET losses = losses + 1, updated_at = NOW()
-			WHERE user_id = $1
-			RETURNING user_id, username, score, wins, losses, draws, rank
-		`
-		args = []interface{}{input.UserID}
+		column = "wins"
 	}
 
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("Error starting transaction: %v", err)
+		return "", runtime.NewError("Error updating player stats", 500)
+	}
+	defer tx.Rollback()
+
 	var dbUserID, dbUsername string
-	var score, wins, losses, draws, rank int
+	var score, wins, losses, draws int
 
-	err := db.QueryRowContext(ctx, query, args...).Scan(&dbUserID, &dbUsername, &score, &wins, &losses, &draws, &rank)
+	err = tx.QueryRowContext(ctx, `
+		UPDATE player_stats
+		SET `+column+` = `+column+` + 1, updated_at = NOW()
+		WHERE user_id = $1
+		RETURNING user_id, username, score, wins, losses, draws
+	`, input.UserID).Scan(&dbUserID, &dbUsername, &score, &wins, &losses, &draws)
+	if err == sql.ErrNoRows {
+		return "", runtime.NewError("Player not found", 404)
+	}
 	if err != nil {
 		logger.Error("Error updating player stats: %v", err)
 		return "", runtime.NewError("Error updating player stats", 500)
 	}
-
-	// Update ranks for all players
-	_, err = db.ExecContext(ctx, `
-		WITH ranked_players AS (
-			SELECT user_id, RANK() OVER (ORDER BY score DESC) as new_rank
-			FROM player_stats
-		)
-		UPDATE player_stats ps
-		SET rank = rp.new_rank
-		FROM ranked_players rp
-		WHERE ps.user_id = rp.user_id
-	`)
-
+	err = auditStatChange(ctx, tx, input.UserID, StatSourceServer, "", map[string]interface{}{
+		"column": column,
+		"change": 1,
+		"reason": input.Reason,
+	})
 	if err != nil {
-		logger.Error("Error updating player ranks: %v", err)
-		// Continue despite error in rank update
+		logger.Error("Error auditing player stats: %v", err)
+		return "", runtime.NewError("Error updating player stats", 500)
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("Error committing player stats: %v", err)
+		return "", runtime.NewError("Error updating player stats", 500)
 	}
 
 	// Return updated player stats
@@ -181,7 +194,6 @@ func updatePlayerStats(ctx context.Context, logger runtime.Logger, db *sql.DB, n
 		"wins":     wins,
 		"losses":   losses,
 		"draws":    draws,
-		"rank":     rank,
 	}
 
 	jsonResult, err := json.Marshal(result)
@@ -193,87 +205,49 @@ func updatePlayerStats(ctx context.Context, logger runtime.Logger, db *sql.DB, n
 	return string(jsonResult), nil
 }
 
-// getLeaderboard returns the top players
-func getLeaderboard(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-	// Parse payload for limit
-	var input struct {
-		Limit int `json:"limit"`
-	}
-
-	if err := json.Unmarshal([]byte(payload), &input); err != nil {
-		// Default to 10 if not specified
-		input.Limit = 10
-	}
-
-	if input.Limit <= 0 {
-		input.Limit = 10
+// getBotStats returns the caller's record against the bot at each difficulty
+func getBotStats(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", runtime.NewError("User ID not found", 401)
 	}
 
-	// Query top players
-	query := `
-		SELECT user_id, username, score, wins, losses, draws, rank
-		FROM player_stats
-		ORDER BY score DESC
-		LIMIT $1
-	`
-
-	rows, err := db.QueryContext(ctx, query, input.Limit)
+	rows, err := db.QueryContext(ctx, `
+		SELECT difficulty, wins, losses, draws
+		FROM bot_stats
+		WHERE user_id = $1
+		ORDER BY difficulty
+	`, userID)
 	if err != nil {
-		logger.Error("Error querying leaderboard: %v", err)
-		return "", runtime.NewError("Error retrieving leaderboard", 500)
+		logger.Error("Error querying bot stats: %v", err)
+		return "", runtime.NewError("Error retrieving bot stats", 500)
 	}
 	defer rows.Close()
 
-	// Build leaderboard result
-	var leaderboard []map[string]interface{}
-
+	stats := []map[string]interface{}{}
 	for rows.Next() {
-		var userID, username string
-		var score, wins, losses, draws, rank int
-
-		if err := rows.Scan(&userID, &username, &score, &wins, &losses, &draws, &rank); err != nil {
-			logger.Error("Error scanning leaderboard row: %v", err)
+		var difficulty string
+		var wins, losses, draws int
+		if err := rows.Scan(&difficulty, &wins, &losses, &draws); err != nil {
+			logger.Error("Error scanning bot stats row: %v", err)
 			continue
 		}
-
-		leaderboard = append(leaderboard, map[string]interface{}{
-			"user_id":  userID,
-			"username": username,
-			"score":    score,
-			"wins":     wins,
-			"losses":   losses,
-			"draws":    draws,
-			"rank":     rank,
+		stats = append(stats, map[string]interface{}{
+			"difficulty": difficulty,
+			"wins":       wins,
+			"losses":     losses,
+			"draws":      draws,
 		})
 	}
 
-	// Return leaderboard as JSON
-	result := map[string]interface{}{
-		"leaderboard": leaderboard,
-	}
-
-	jsonResult, err := json.Marshal(result)
+	jsonResult, err := json.Marshal(map[string]interface{}{"bot_stats": stats})
 	if err != nil {
 		logger.Error("Error marshaling result: %v", err)
-		return "", runtime.NewError("Error processing result", 500)
+		return "", runtime.NewError("Error processing bot stats", 500)
 	}
-
 	return string(jsonResult), nil
 }
 
-// beforeMatchCreate is called before a match is created
-func beforeMatchCreate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, matchID string, node string, params map[string]interface{}) (map[string]interface{}, error) {
-	// Check if this is a bot match
-	isBotMatch, ok := params["bot_match"].(bool)
-	if ok && isBotMatch {
-		// Add bot flag to match params
-		params["bot_match"] = true
-		params["bot_difficulty"] = params["bot_difficulty"].(string)
-	}
-
-	return params, nil
-}
-
 // --- Email verification types and RPCs ---
 type verifyStorage struct {
     Code      string    `json:"code"`
@@ -383,6 +357,8 @@ func getVerificationStatus(ctx context.Context, logger runtime.Logger, db *sql.D
 
 
 
+// rpcMakeMove plays a move through the authoritative match so clients without a
+// socket can play; the match validates it exactly like a socket move
 func rpcMakeMove(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
 	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
 	if !ok {
@@ -391,27 +367,79 @@ func rpcMakeMove(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runt
 
 	var input struct {
 		MatchID string `json:"match_id"`
-		Move    int    `json:"move"`
+		Move    *int   `json:"move"` // row-major cell index
+		Row     *int   `json:"row"`
+		Col     *int   `json:"col"`
 	}
 
 	if err := json.Unmarshal([]byte(payload), &input); err != nil {
 		return "", runtime.NewError("Invalid payload", 400)
 	}
+	if input.MatchID == "" || (input.Move == nil && (input.Row == nil || input.Col == nil)) {
+		return "", runtime.NewError("match_id and either move or row and col are required", 400)
+	}
 
-	// In a real-world scenario, you would have a more complex state management.
-	// For this example, we'll just broadcast the move to the other player.
-
-	// Create the data to send
-	data, _ := json.Marshal(map[string]interface{}{
-		"move":     input.Move,
-		"sender":   userID,
-		"op_code":  1, // OpCode for a move
+	return signalMatch(ctx, logger, nk, input.MatchID, signalCommand{
+		Command: SignalMove,
+		UserID:  userID,
+		Row:     input.Row,
+		Col:     input.Col,
+		Index:   input.Move,
 	})
+}
 
-	// Send the data to the match
-	nk.MatchSignal(ctx, input.MatchID, string(data))
+// rpcAbortMatch ends a running series as a draw. Like update_player_stats it
+// is reserved for server-to-server calls made with the http_key.
+func rpcAbortMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	if callerID, _ := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string); callerID != "" {
+		logger.Warn("User %s called abort_match", callerID)
+		return "", runtime.NewError("abort_match is only available to the server", 403)
+	}
+
+	var input struct {
+		MatchID string `json:"match_id"`
+	}
 
-	return "{\"success\":true}", nil
+	if err := json.Unmarshal([]byte(payload), &input); err != nil {
+		return "", runtime.NewError("Invalid payload", 400)
+	}
+	if input.MatchID == "" {
+		return "", runtime.NewError("match_id is required", 400)
+	}
+
+	logger.Info("Aborting match %s", input.MatchID)
+	return signalMatch(ctx, logger, nk, input.MatchID, signalCommand{Command: SignalAbort})
+}
+
+// signalMatch sends a signed command to a match and relays its result, adding
+// the legacy "success" flag
+func signalMatch(ctx context.Context, logger runtime.Logger, nk runtime.NakamaModule, matchID string, cmd signalCommand) (string, error) {
+	data, err := signSignal(cmd)
+	if err != nil {
+		logger.Error("Error signing match signal: %v", err)
+		return "", runtime.NewError("Error processing request", 500)
+	}
+
+	resultJSON, err := nk.MatchSignal(ctx, matchID, data)
+	if err != nil {
+		logger.Warn("Error signalling match %s: %v", matchID, err)
+		return "", runtime.NewError("Match not found", 404)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal([]byte(resultJSON), &result); err != nil {
+		logger.Error("Error parsing match signal result: %v", err)
+		return "", runtime.NewError("Error processing result", 500)
+	}
+	result["success"] = result["accepted"]
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("Error marshaling result: %v", err)
+		return "", runtime.NewError("Error processing result", 500)
+	}
+
+	return string(response), nil
 }
 
 func rpcListRooms(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
@@ -430,10 +458,22 @@ func rpcListRooms(ctx context.Context, logger runtime.Logger, db *sql.DB, nk run
 	for _, match := range matches {
 		if _, ok := deduplicatedMatches[match.MatchId]; !ok {
 			deduplicatedMatches[match.MatchId] = true
+
+			// Older matches may not carry the variant in their label
+			label := matchLabel{BoardSize: game.DefaultSize, WinLength: game.DefaultWinLength, BestOf: 1}
+			if match.GetLabel() != nil {
+				_ = json.Unmarshal([]byte(match.GetLabel().GetValue()), &label)
+			}
+
 			matchList = append(matchList, map[string]interface{}{
 				"match_id":     match.MatchId,
 				"authoritative": match.Authoritative,
 				"size":         match.Size,
+				"open":         label.Open,
+				"board_size":   label.BoardSize,
+				"win_length":   label.WinLength,
+				"spectators":   label.Spectators,
+				"best_of":      label.BestOf,
 			})
 		}
 	}
@@ -455,7 +495,73 @@ func rpcListRooms(ctx context.Context, logger runtime.Logger, db *sql.DB, nk run
 }
 
 func rpcCreateRoom(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-	matchID, err := nk.MatchCreate(ctx, "tic_tac_toe", map[string]interface{}{"name": "New Room"})
+	var input struct {
+		BoardSize       int  `json:"board_size"`
+		WinLength       int  `json:"win_length"`
+		MoveTimeSec     *int `json:"move_time_sec"`
+		GameTimeSec     *int `json:"game_time_sec"`
+		IncrementSec    *int `json:"increment_sec"`
+		ReconnectSec    *int `json:"reconnect_window_sec"`
+		RematchSec      *int `json:"rematch_window_sec"`
+		CloseAfterSec   *int `json:"close_after_sec"`
+		EmptyTimeoutSec *int `json:"empty_timeout_sec"`
+		BestOf          int  `json:"best_of"`
+	}
+
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			return "", runtime.NewError("Invalid payload", 400)
+		}
+	}
+
+	// Validate the variant up front so callers get a useful error
+	if input.BoardSize == 0 {
+		input.BoardSize = game.DefaultSize
+	}
+	if input.WinLength == 0 {
+		input.WinLength = game.DefaultWinLengthFor(input.BoardSize)
+	}
+	if _, err := game.NewBoard(input.BoardSize, input.WinLength); err != nil {
+		return "", runtime.NewError("Invalid board variant: "+err.Error(), 400)
+	}
+	if input.BestOf == 0 {
+		input.BestOf = 1
+	}
+	if input.BestOf < 1 || input.BestOf > MaxBestOf || input.BestOf%2 == 0 {
+		return "", runtime.NewError("best_of must be an odd number of games up to "+strconv.Itoa(MaxBestOf), 400)
+	}
+
+	params := map[string]interface{}{
+		"name":       "New Room",
+		"board_size": input.BoardSize,
+		"win_length": input.WinLength,
+		"best_of":    input.BestOf,
+	}
+
+	// Only forward time control the caller set so the match defaults apply
+	if input.MoveTimeSec != nil {
+		params["move_time_sec"] = *input.MoveTimeSec
+	}
+	if input.GameTimeSec != nil {
+		params["game_time_sec"] = *input.GameTimeSec
+	}
+	if input.IncrementSec != nil {
+		params["increment_sec"] = *input.IncrementSec
+	}
+	if input.ReconnectSec != nil {
+		params["reconnect_window_sec"] = *input.ReconnectSec
+	}
+	if input.RematchSec != nil {
+		params["rematch_window_sec"] = *input.RematchSec
+	}
+	if input.CloseAfterSec != nil {
+		params["close_after_sec"] = *input.CloseAfterSec
+	}
+	if input.EmptyTimeoutSec != nil {
+		params["empty_timeout_sec"] = *input.EmptyTimeoutSec
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "tic_tac_toe", params)
 	if err != nil {
 		logger.Error("Error creating match: %v", err)
 		return "", err
@@ -467,19 +573,185 @@ func rpcCreateRoom(ctx context.Context, logger runtime.Logger, db *sql.DB, nk ru
 	return string(jsonResponse), nil
 }
 
+// rpcCreateBotMatch creates an authoritative match against the bot for the
+// caller, who plays the requested side
+func rpcCreateBotMatch(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", runtime.NewError("User ID not found", 401)
+	}
+
+	var input struct {
+		Difficulty string `json:"difficulty"`
+		Level      int    `json:"level"`
+		BoardSize  int    `json:"board_size"`
+		WinLength  int    `json:"win_length"`
+		PlayAs     string `json:"play_as"`
+		BestOf     int    `json:"best_of"`
+	}
+
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &input); err != nil {
+			return "", runtime.NewError("Invalid payload", 400)
+		}
+	}
+
+	if input.Difficulty == "" {
+		input.Difficulty = "medium"
+	}
+	if !validBotDifficulty(input.Difficulty) {
+		return "", runtime.NewError("Unknown difficulty: "+input.Difficulty, 400)
+	}
+	if input.Level != 0 && (input.Level < bot.MinLevel || input.Level > bot.MaxLevel) {
+		return "", runtime.NewError("level must be between "+strconv.Itoa(bot.MinLevel)+" and "+strconv.Itoa(bot.MaxLevel), 400)
+	}
+	if input.BoardSize == 0 {
+		input.BoardSize = game.DefaultSize
+	}
+	if input.WinLength == 0 {
+		input.WinLength = game.DefaultWinLengthFor(input.BoardSize)
+	}
+	if _, err := game.NewBoard(input.BoardSize, input.WinLength); err != nil {
+		return "", runtime.NewError("Invalid board variant: "+err.Error(), 400)
+	}
+	switch input.PlayAs {
+	case "":
+		input.PlayAs = PlayerMarkX
+	case PlayerMarkX, PlayerMarkO, PlayerMarkRandom:
+	default:
+		return "", runtime.NewError("play_as must be x, o or random", 400)
+	}
+	if input.BestOf == 0 {
+		input.BestOf = 1
+	}
+	if input.BestOf < 1 || input.BestOf > MaxBestOf || input.BestOf%2 == 0 {
+		return "", runtime.NewError("best_of must be an odd number of games up to "+strconv.Itoa(MaxBestOf), 400)
+	}
+
+	params := map[string]interface{}{
+		"bot_match":      true,
+		"bot_difficulty": input.Difficulty,
+		"board_size":     input.BoardSize,
+		"win_length":     input.WinLength,
+		"player_mark":    input.PlayAs,
+		"best_of":        input.BestOf,
+		"reserved":       []string{userID},
+	}
+	if input.Level != 0 {
+		params["bot_level"] = input.Level
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "tic_tac_toe", params)
+	if err != nil {
+		logger.Error("Error creating bot match: %v", err)
+		return "", runtime.NewError("Error creating bot match", 500)
+	}
+
+	jsonResponse, _ := json.Marshal(map[string]string{"match_id": matchID})
+	return string(jsonResponse), nil
+}
+
+// validBotDifficulty reports whether a bot match can be created with difficulty
+func validBotDifficulty(difficulty string) bool {
+	if difficulty == AdaptiveDifficulty {
+		return true
+	}
+	for _, name := range bot.Names() {
+		if name == difficulty {
+			return true
+		}
+	}
+	return false
+}
+
 func rpcJoinRoom(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
-    _, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+    userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
     if !ok {
 		return "", runtime.NewError("User ID not found", 401)
 	}
 
 	var input struct {
 		MatchID string `json:"match_id"`
+		Seat    bool   `json:"seat"` // take a seat now, for clients playing over RPC only
 	}
 
 	if err := json.Unmarshal([]byte(payload), &input); err != nil {
 		return "", runtime.NewError("Invalid payload", 400)
 	}
 
+	if input.Seat {
+		return signalMatch(ctx, logger, nk, input.MatchID, signalCommand{Command: SignalJoin, UserID: userID})
+	}
+
 	return "{\"success\":true,\"match_id\":\"" + input.MatchID + "\"}", nil
 }
+
+// MaxAnalysisBudgetMs caps how long analyze_position lets a strategy think
+const MaxAnalysisBudgetMs = 2000
+
+func rpcAnalyzePosition(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var input struct {
+		Board    game.Board `json:"board"`
+		Mark     game.Mark  `json:"mark"`
+		Strategy string     `json:"strategy"`
+		BudgetMs int        `json:"budget_ms"`
+	}
+
+	if err := json.Unmarshal([]byte(payload), &input); err != nil {
+		return "", runtime.NewError("Invalid payload", 400)
+	}
+
+	// Rebuild the board so malformed cells cannot reach the strategy
+	board, err := game.NewBoard(input.Board.Size, input.Board.WinLength)
+	if err != nil {
+		return "", runtime.NewError("Invalid board variant: "+err.Error(), 400)
+	}
+	if len(input.Board.Cells) != board.Size {
+		return "", runtime.NewError("Board cells do not match its size", 400)
+	}
+	for i, row := range input.Board.Cells {
+		if len(row) != board.Size {
+			return "", runtime.NewError("Board cells do not match its size", 400)
+		}
+		for j, cell := range row {
+			if cell != game.Empty && cell != game.X && cell != game.O {
+				return "", runtime.NewError("Invalid cell value", 400)
+			}
+			board.Cells[i][j] = cell
+		}
+	}
+	if input.Mark != game.X && input.Mark != game.O {
+		return "", runtime.NewError("mark must be 1 (X) or 2 (O)", 400)
+	}
+	if board.Outcome().Finished() {
+		return "", runtime.NewError("Position is already decided", 400)
+	}
+
+	if input.Strategy == "" {
+		input.Strategy = "hard"
+	}
+	strategy, err := bot.New(input.Strategy, rand.New(rand.NewSource(time.Now().UnixNano())))
+	if err != nil {
+		return "", runtime.NewError("Unknown strategy, expected one of: "+strings.Join(bot.Names(), ", "), 400)
+	}
+	budgetMs := input.BudgetMs
+	if budgetMs <= 0 || budgetMs > MaxAnalysisBudgetMs {
+		budgetMs = MaxAnalysisBudgetMs
+	}
+
+	move, err := strategy.ChooseMove(board, input.Mark, time.Duration(budgetMs)*time.Millisecond)
+	if err != nil {
+		logger.Error("Error analyzing position: %v", err)
+		return "", runtime.NewError("Unable to choose a move", 500)
+	}
+
+	response := map[string]interface{}{
+		"strategy": input.Strategy,
+		"row":      move.Row,
+		"col":      move.Col,
+		"move":     move.Row*board.Size + move.Col,
+	}
+	jsonResponse, _ := json.Marshal(response)
+
+	return string(jsonResponse), nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/rtapi"
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/game"
+	"nakama-arena/modules/rating"
+)
+
+// Matchmaking modes; ranked tickets are paired by rating, casual ones by
+// variant only
+const (
+	MatchmakingModeRanked = "ranked"
+	MatchmakingModeCasual = "casual"
+)
+
+const (
+	// BaseSkillWindow is the rating gap a ranked ticket accepts straight away
+	BaseSkillWindow = 100
+	// SkillWindowGrowthPerSec widens the window the longer a player waits
+	SkillWindowGrowthPerSec = 10
+	// MaxSkillWindow caps the window until OpenSkillAfterSec
+	MaxSkillWindow = 500
+	// OpenSkillAfterSec is how long a player waits before any rating is accepted
+	OpenSkillAfterSec = 60
+	// MatchmakingRequeueSec is how often clients should resubmit their ticket
+	// so the window widens
+	MatchmakingRequeueSec = 10
+	// matchmakingStaleSec is how long after its last submission a ticket stops
+	// counting towards the time waited
+	matchmakingStaleSec = 3 * MatchmakingRequeueSec
+)
+
+// skillWindow returns the rating gap accepted after waiting waitSec seconds,
+// or -1 once any rating is accepted
+func skillWindow(waitSec int) int {
+	if waitSec >= OpenSkillAfterSec {
+		return -1
+	}
+	return min(BaseSkillWindow+SkillWindowGrowthPerSec*max(waitSec, 0), MaxSkillWindow)
+}
+
+// playerRating returns the Glicko-2 rating matchmaking pairs userID by
+func playerRating(ctx context.Context, db *sql.DB, userID string) (float64, error) {
+	var r float64
+	err := db.QueryRowContext(ctx, `SELECT rating FROM player_stats WHERE user_id = $1`, userID).Scan(&r)
+	if err == sql.ErrNoRows {
+		return rating.DefaultRating, nil
+	}
+	return r, err
+}
+
+// matchmakingTicket is the mode and game variant a player is searching for
+type matchmakingTicket struct {
+	Mode      string `json:"mode"`
+	BoardSize int    `json:"board_size"`
+	WinLength int    `json:"win_length"`
+	BestOf    int    `json:"best_of"`
+}
+
+// validate fills in defaults and checks the ticket, returning an error fit to
+// show the client
+func (t *matchmakingTicket) validate() error {
+	switch t.Mode {
+	case "":
+		t.Mode = MatchmakingModeRanked
+	case MatchmakingModeRanked, MatchmakingModeCasual:
+	default:
+		return runtime.NewError("mode must be ranked or casual", 400)
+	}
+	if t.BoardSize == 0 {
+		t.BoardSize = game.DefaultSize
+	}
+	if t.WinLength == 0 {
+		t.WinLength = game.DefaultWinLengthFor(t.BoardSize)
+	}
+	if _, err := game.NewBoard(t.BoardSize, t.WinLength); err != nil {
+		return runtime.NewError("Invalid board variant: "+err.Error(), 400)
+	}
+	if t.BestOf == 0 {
+		t.BestOf = 1
+	}
+	if t.BestOf < 1 || t.BestOf > MaxBestOf || t.BestOf%2 == 0 {
+		return runtime.NewError("best_of must be an odd number of games up to "+strconv.Itoa(MaxBestOf), 400)
+	}
+	return nil
+}
+
+// ticketFromProperties reads a ticket back from matchmaker string properties.
+// Missing properties take the casual mode and the default variant.
+func ticketFromProperties(properties map[string]string) (matchmakingTicket, error) {
+	ticket := matchmakingTicket{Mode: properties["mode"]}
+	if ticket.Mode == "" {
+		ticket.Mode = MatchmakingModeCasual
+	}
+	for key, field := range map[string]*int{"board_size": &ticket.BoardSize, "win_length": &ticket.WinLength, "best_of": &ticket.BestOf} {
+		value, ok := properties[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return ticket, runtime.NewError("Invalid matchmaker "+key+" property", 400)
+		}
+		*field = n
+	}
+	return ticket, ticket.validate()
+}
+
+// key identifies the mode and variant for queueWait
+func (t matchmakingTicket) key() string {
+	return fmt.Sprintf("%s/%d/%d/%d", t.Mode, t.BoardSize, t.WinLength, t.BestOf)
+}
+
+// properties returns the ticket's matchmaker string properties
+func (t matchmakingTicket) properties() map[string]string {
+	return map[string]string{
+		"mode":       t.Mode,
+		"board_size": strconv.Itoa(t.BoardSize),
+		"win_length": strconv.Itoa(t.WinLength),
+		"best_of":    strconv.Itoa(t.BestOf),
+	}
+}
+
+// query builds the matchmaker query: the same mode and variant, and for ranked
+// tickets a rating within window of the player's
+func (t matchmakingTicket) query(skill float64, window int) string {
+	query := fmt.Sprintf("+properties.mode:%s +properties.board_size:%d +properties.win_length:%d +properties.best_of:%d", t.Mode, t.BoardSize, t.WinLength, t.BestOf)
+	if t.Mode == MatchmakingModeRanked && window >= 0 {
+		low, high := math.Floor(skill)-float64(window), math.Ceil(skill)+float64(window)
+		query += fmt.Sprintf(" +properties.rating:>=%g +properties.rating:<=%g", low, high)
+	}
+	return query
+}
+
+// queueWait records a submission of userID's ticket and returns how many
+// seconds they have been searching for it. The clock restarts when the ticket
+// changes or has not been resubmitted for matchmakingStaleSec.
+func queueWait(ctx context.Context, db *sql.DB, userID string, ticket matchmakingTicket) (int, error) {
+	query := `
+		INSERT INTO matchmaking_queue (user_id, ticket, queued_at, requeued_at)
+		VALUES ($1, $2, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+			queued_at = CASE
+				WHEN matchmaking_queue.ticket = EXCLUDED.ticket
+					AND matchmaking_queue.requeued_at > NOW() - $3 * INTERVAL '1 second'
+				THEN matchmaking_queue.queued_at
+				ELSE NOW()
+			END,
+			ticket = EXCLUDED.ticket,
+			requeued_at = NOW()
+		RETURNING EXTRACT(EPOCH FROM NOW() - matchmaking_queue.queued_at)
+	`
+	var waited float64
+	if err := db.QueryRowContext(ctx, query, userID, ticket.key(), matchmakingStaleSec).Scan(&waited); err != nil {
+		return 0, err
+	}
+	return int(waited), nil
+}
+
+// rpcMatchmakingTicket builds the matchmaker ticket for the caller's mode and
+// variant preferences. Clients submit it with the socket's matchmaker add and
+// resubmit it every requeue_after_sec; beforeMatchmakerAdd sets the query.
+func rpcMatchmakingTicket(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return "", runtime.NewError("User ID not found", 401)
+	}
+
+	var ticket matchmakingTicket
+	if payload != "" {
+		if err := json.Unmarshal([]byte(payload), &ticket); err != nil {
+			return "", runtime.NewError("Invalid payload", 400)
+		}
+	}
+	if err := ticket.validate(); err != nil {
+		return "", err
+	}
+
+	skill, err := playerRating(ctx, db, userID)
+	if err != nil {
+		logger.Error("Error reading rating for matchmaking: %v", err)
+		return "", runtime.NewError("Error reading rating", 500)
+	}
+	window := skillWindow(0)
+
+	response := map[string]interface{}{
+		"query":              ticket.query(skill, window),
+		"min_count":          2,
+		"max_count":          2,
+		"string_properties":  ticket.properties(),
+		"numeric_properties": map[string]float64{"rating": skill},
+		"skill_window":       window,
+		"requeue_after_sec":  MatchmakingRequeueSec,
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		logger.Error("Error marshaling result: %v", err)
+		return "", runtime.NewError("Error processing ticket", 500)
+	}
+	return string(jsonResponse), nil
+}
+
+// beforeMatchmakerAdd rebuilds every ticket from the rating on record, the
+// validated mode and variant and the time the server has seen the player
+// searching, so players cannot claim another skill bracket or widen their
+// window early. Tickets without a mode are treated as casual.
+func beforeMatchmakerAdd(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, in *rtapi.Envelope) (*rtapi.Envelope, error) {
+	add := in.GetMatchmakerAdd()
+	if add == nil {
+		return in, nil
+	}
+	userID, ok := ctx.Value(runtime.RUNTIME_CTX_USER_ID).(string)
+	if !ok || userID == "" {
+		return nil, runtime.NewError("User ID not found", 401)
+	}
+
+	ticket, err := ticketFromProperties(add.StringProperties)
+	if err != nil {
+		return nil, err
+	}
+	skill, err := playerRating(ctx, db, userID)
+	if err != nil {
+		logger.Error("Error reading rating for matchmaking: %v", err)
+		return nil, runtime.NewError("Error reading rating", 500)
+	}
+	waited, err := queueWait(ctx, db, userID, ticket)
+	if err != nil {
+		logger.Error("Error tracking matchmaking wait: %v", err)
+		return nil, runtime.NewError("Error processing ticket", 500)
+	}
+
+	add.Query = ticket.query(skill, skillWindow(waited))
+	add.StringProperties = ticket.properties()
+	add.NumericProperties = map[string]float64{"rating": skill}
+	add.MinCount, add.MaxCount = 2, 2
+	return in, nil
+}
+
+// matchmakerMatched creates the authoritative match for a matched pair of
+// tickets, reserving its seats for them
+func matchmakerMatched(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, entries []runtime.MatchmakerEntry) (string, error) {
+	if len(entries) != 2 {
+		return "", runtime.NewError("Matchmaker produced an unsupported number of players", 3)
+	}
+
+	properties := entries[0].GetProperties()
+	userIDs := []string{entries[0].GetPresence().GetUserId(), entries[1].GetPresence().GetUserId()}
+	params := map[string]interface{}{
+		"ranked":   properties["mode"] == MatchmakingModeRanked,
+		"reserved": userIDs,
+	}
+	for _, key := range []string{"board_size", "win_length", "best_of"} {
+		value, _ := properties[key].(string)
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			logger.Error("Invalid matchmaker %s property: %v", key, properties[key])
+			return "", runtime.NewError("Invalid matchmaker ticket", 3)
+		}
+		params[key] = n
+	}
+
+	matchID, err := nk.MatchCreate(ctx, "tic_tac_toe", params)
+	if err != nil {
+		logger.Error("Error creating matchmade match: %v", err)
+		return "", err
+	}
+
+	// The pair has stopped searching, so their next tickets start a new wait
+	if _, err := db.ExecContext(ctx, `DELETE FROM matchmaking_queue WHERE user_id = $1 OR user_id = $2`, userIDs[0], userIDs[1]); err != nil {
+		logger.Warn("Error clearing matchmaking queue: %v", err)
+	}
+	return matchID, nil
+}
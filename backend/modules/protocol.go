@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/game"
+)
+
+// Protocol versions understood by the match handler. Clients send theirs as
+// "protocol_version" in join metadata; clients that omit it speak version 1.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+// Client to server opcodes
+const (
+	OpCodeMove          int64 = 1  // moveRequest
+	OpCodeResyncRequest int64 = 9  // empty payload; answered with OpCodeStateSnapshot
+	OpCodeRematchOffer  int64 = 11 // empty payload; offer to play again once the match is complete
+	OpCodeRematchAccept int64 = 12 // empty payload; accept the opponent's pending offer
+)
+
+// Server to client opcodes
+const (
+	OpCodeGameReady            int64 = 1  // statusMessage
+	OpCodeGameStarted          int64 = 2  // statusMessage
+	OpCodeGameOver             int64 = 3  // gameOverMessage
+	OpCodeMoveMade             int64 = 4  // moveMadeMessage
+	OpCodeClock                int64 = 5  // clockMessage
+	OpCodeOpponentDisconnected int64 = 6  // disconnectedMessage
+	OpCodeOpponentReconnected  int64 = 7  // reconnectedMessage
+	OpCodeStateSnapshot        int64 = 8  // stateSnapshot
+	OpCodeRejected             int64 = 10 // rejectionMessage
+	OpCodeRematchOffered       int64 = 11 // rematchMessage
+	OpCodeMatchClosed          int64 = 12 // closedMessage
+)
+
+// Errors reported back to clients whose requests are rejected
+var (
+	errNotYourTurn        = errors.New("not your turn")
+	errNotAPlayer         = errors.New("not a player in this match")
+	errSpectator          = errors.New("spectators cannot move")
+	errGameNotInProgress  = errors.New("game not in progress")
+	errInvalidPayload     = errors.New("invalid payload")
+	errUnknownOpCode      = errors.New("unknown opcode")
+	errRematchUnavailable = errors.New("rematch not available")
+	errNoRematchOffer     = errors.New("no rematch offer to accept")
+)
+
+// rejectionCodes maps request errors to stable codes clients can switch on
+var rejectionCodes = map[error]string{
+	errNotYourTurn:        "not_your_turn",
+	errNotAPlayer:         "not_a_player",
+	errSpectator:          "spectator",
+	errGameNotInProgress:  "game_not_in_progress",
+	errInvalidPayload:     "invalid_payload",
+	errUnknownOpCode:      "unknown_opcode",
+	errRematchUnavailable: "rematch_unavailable",
+	errNoRematchOffer:     "no_rematch_offer",
+	errBadSignature:       "bad_signature",
+	errSignalExpired:      "signal_expired",
+	errUnknownCommand:     "unknown_command",
+	errMatchFull:          "match_full",
+	errMatchReserved:      "match_reserved",
+	game.ErrOutOfBounds:   "out_of_bounds",
+	game.ErrCellOccupied:  "cell_occupied",
+	game.ErrInvalidMark:   "invalid_mark",
+}
+
+// moveRequest is sent by a player to place their mark
+type moveRequest struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// statusMessage carries a human-readable lifecycle notification
+type statusMessage struct {
+	Message string `json:"message"`
+}
+
+// gameOverMessage announces the result of a game and the state of its series
+type gameOverMessage struct {
+	Message      string         `json:"message"`
+	Reason       string         `json:"reason"`           // line, draw, forfeit, timeout, inactivity, aborted, abandoned or terminated
+	Winner       string         `json:"winner,omitempty"` // user ID of the winner, empty for draws
+	Outcome      game.Outcome   `json:"outcome"`
+	Round        int            `json:"round"`
+	BestOf       int            `json:"best_of"`
+	SeriesScore  map[string]int `json:"series_score"` // games won per user ID
+	SeriesOver   bool           `json:"series_over"`
+	SeriesWinner string         `json:"series_winner,omitempty"` // empty while running or for a drawn series
+}
+
+// moveMadeMessage announces an accepted move
+type moveMadeMessage struct {
+	Row         int       `json:"row"`
+	Col         int       `json:"col"`
+	Mark        game.Mark `json:"mark"`
+	CurrentTurn game.Mark `json:"current_turn"`
+}
+
+// clockMessage is broadcast every tick while a clocked game is running
+type clockMessage struct {
+	CurrentTurn     game.Mark        `json:"current_turn"`
+	MoveRemainingMs int64            `json:"move_remaining_ms"` // -1 when no move clock is running
+	Clocks          map[string]int64 `json:"clocks"`
+	IncrementMs     int64            `json:"increment_ms"`
+}
+
+// disconnectedMessage counts down a dropped player's reconnect window
+type disconnectedMessage struct {
+	Message          string `json:"message"`
+	UserID           string `json:"user_id"`
+	SecondsRemaining int64  `json:"seconds_remaining"`
+}
+
+// reconnectedMessage announces that a dropped player is back
+type reconnectedMessage struct {
+	Message string `json:"message"`
+	UserID  string `json:"user_id"`
+}
+
+// rematchMessage lists the players that want a rematch and the time left to agree
+type rematchMessage struct {
+	Offers           []string `json:"offers"` // user IDs, the bot offers automatically
+	SecondsRemaining int64    `json:"seconds_remaining"`
+}
+
+// closedMessage is broadcast right before the match ends
+type closedMessage struct {
+	Message          string `json:"message"`
+	Reason           string `json:"reason"`                      // complete, empty or shutdown
+	SecondsRemaining int64  `json:"seconds_remaining,omitempty"` // grace period left on shutdown
+}
+
+// rejectionMessage is sent only to the presence whose request was refused
+type rejectionMessage struct {
+	OpCode  int64  `json:"op_code"` // opcode of the rejected request
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// newRejection builds the rejection for a failed request
+func newRejection(opCode int64, err error) rejectionMessage {
+	code, ok := rejectionCodes[err]
+	if !ok {
+		code = "rejected"
+	}
+	return rejectionMessage{OpCode: opCode, Code: code, Message: err.Error()}
+}
+
+// negotiateProtocol picks the protocol version to speak with a joining client
+func negotiateProtocol(metadata map[string]string) (int, bool) {
+	requested, ok := metadata["protocol_version"]
+	if !ok || requested == "" {
+		return MinProtocolVersion, true
+	}
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < MinProtocolVersion {
+		return 0, false
+	}
+	return min(version, ProtocolVersion), true
+}
+
+// broadcast sends a typed message to the given presences, or every connected
+// presence when nil, encoding it the way each recipient negotiated
+func (m *TicTacToeMatch) broadcast(dispatcher runtime.MatchDispatcher, s *TicTacToeState, opCode int64, message protoMessage, presences []runtime.Presence) {
+	if presences == nil {
+		presences = s.presenceList()
+	}
+
+	var jsonTargets, protoTargets []runtime.Presence
+	for _, presence := range presences {
+		if s.Encodings[presence.GetUserId()] == EncodingProtobuf {
+			protoTargets = append(protoTargets, presence)
+		} else {
+			jsonTargets = append(jsonTargets, presence)
+		}
+	}
+
+	// An empty presence list means everyone to Nakama, so skip empty groups
+	if len(jsonTargets) > 0 {
+		data, err := json.Marshal(message)
+		if err != nil {
+			m.logger.Error("Error marshaling message for opcode %d: %v", opCode, err)
+		} else if err := dispatcher.BroadcastMessage(opCode, data, jsonTargets, nil, true); err != nil {
+			m.logger.Error("Error broadcasting opcode %d: %v", opCode, err)
+		}
+	}
+	if len(protoTargets) > 0 {
+		if err := dispatcher.BroadcastMessage(opCode, message.marshalProto(), protoTargets, nil, true); err != nil {
+			m.logger.Error("Error broadcasting opcode %d: %v", opCode, err)
+		}
+	}
+}
+
+// reject tells a single presence why its request was refused
+func (m *TicTacToeMatch) reject(dispatcher runtime.MatchDispatcher, s *TicTacToeState, presence runtime.Presence, opCode int64, err error) {
+	m.broadcast(dispatcher, s, OpCodeRejected, newRejection(opCode, err), []runtime.Presence{presence})
+}
+
+// decodeMove parses a move request in the sender's negotiated encoding
+func decodeMove(s *TicTacToeState, message runtime.MatchData) (moveRequest, error) {
+	var move moveRequest
+	var err error
+	if s.Encodings[message.GetUserId()] == EncodingProtobuf {
+		err = move.unmarshalProto(message.GetData())
+	} else {
+		err = json.Unmarshal(message.GetData(), &move)
+	}
+	return move, err
+}
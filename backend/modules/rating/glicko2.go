@@ -0,0 +1,131 @@
+// Package rating implements the Glicko-2 rating system without any dependency
+// on the Nakama runtime. Every rated match is treated as its own rating
+// period, so ratings move after each result.
+package rating
+
+import "math"
+
+const (
+	// DefaultRating is where new players start
+	DefaultRating = 1500
+	// DefaultDeviation is the uncertainty of a new player's rating
+	DefaultDeviation = 350
+	// DefaultVolatility is the expected fluctuation of a new player's rating
+	DefaultVolatility = 0.06
+
+	// Tau constrains how fast volatility changes; smaller is steadier
+	Tau = 0.5
+	// ConservativeDeviations is how many deviations are taken off a rating
+	// for leaderboard ordering
+	ConservativeDeviations = 2
+
+	// scale converts between the Glicko and Glicko-2 scales
+	scale = 173.7178
+	// convergence is the tolerance of the volatility iteration
+	convergence = 1e-6
+)
+
+// Results of a game from the rated player's point of view
+const (
+	Loss = 0.0
+	Draw = 0.5
+	Win  = 1.0
+)
+
+// Rating is a player's Glicko-2 rating on the familiar Glicko scale
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+}
+
+// Default returns the rating of a player who has not played yet
+func Default() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Conservative returns the rating the player is very likely to be above, so
+// players with few games do not top the leaderboard
+func (r Rating) Conservative() float64 {
+	return r.Rating - ConservativeDeviations*r.Deviation
+}
+
+// Result is one game of a rating period
+type Result struct {
+	Opponent Rating
+	Score    float64 // Loss, Draw or Win
+}
+
+// Update returns the player's rating after scoring score (Loss, Draw or Win)
+// against opponent
+func Update(player, opponent Rating, score float64) Rating {
+	return UpdatePeriod(player, []Result{{Opponent: opponent, Score: score}})
+}
+
+// UpdatePeriod returns the player's rating after a rating period with the
+// given results. A period without games only widens the deviation.
+func UpdatePeriod(player Rating, results []Result) Rating {
+	mu, phi := (player.Rating-DefaultRating)/scale, player.Deviation/scale
+	if len(results) == 0 {
+		phiStar := math.Sqrt(phi*phi + player.Volatility*player.Volatility)
+		return Rating{Rating: player.Rating, Deviation: math.Min(phiStar*scale, DefaultDeviation), Volatility: player.Volatility}
+	}
+
+	var vInv, improvement float64
+	for _, result := range results {
+		muJ, phiJ := (result.Opponent.Rating-DefaultRating)/scale, result.Opponent.Deviation/scale
+		g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-g*(mu-muJ)))
+		vInv += g * g * expected * (1 - expected)
+		improvement += g * (result.Score - expected)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	sigma := volatility(phi, player.Volatility, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phiNew := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	muNew := mu + phiNew*phiNew*improvement
+
+	return Rating{
+		Rating:     muNew*scale + DefaultRating,
+		Deviation:  math.Min(phiNew*scale, DefaultDeviation),
+		Volatility: sigma,
+	}
+}
+
+// volatility finds the new volatility with the Illinois algorithm from step 5
+// of Glickman's description of Glicko-2, keeping its A and B bracket names
+func volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-d)/(2*d*d) - (x-a)/(Tau*Tau)
+	}
+
+	xA := a
+	var xB float64
+	if delta*delta > phi*phi+v {
+		xB = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*Tau) < 0 {
+			k++
+		}
+		xB = a - k*Tau
+	}
+
+	fA, fB := f(xA), f(xB)
+	for math.Abs(xB-xA) > convergence {
+		c := xA + (xA-xB)*fA/(fB-fA)
+		fC := f(c)
+		if fC*fB <= 0 {
+			xA, fA = xB, fB
+		} else {
+			fA /= 2
+		}
+		xB, fB = c, fC
+	}
+	return math.Exp(xA / 2)
+}
@@ -0,0 +1,81 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether got is within tolerance of want
+func near(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+// TestUpdatePeriodGlickmanExample checks the worked example in Glickman's
+// "Example of the Glicko-2 system"
+func TestUpdatePeriodGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []Result{
+		{Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: DefaultVolatility}, Score: Win},
+		{Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: DefaultVolatility}, Score: Loss},
+		{Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: DefaultVolatility}, Score: Loss},
+	}
+	got := UpdatePeriod(player, results)
+	if !near(got.Rating, 1464.06, 0.01) || !near(got.Deviation, 151.52, 0.01) || !near(got.Volatility, 0.05999, 0.00001) {
+		t.Fatalf("UpdatePeriod = %+v, want rating 1464.06, deviation 151.52, volatility 0.05999", got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		player    Rating
+		opponent  Rating
+		score     float64
+		rating    float64
+		deviation float64
+	}{
+		{"new player wins", Default(), Default(), Win, 1662.31, 290.32},
+		{"new player loses", Default(), Default(), Loss, 1337.69, 290.32},
+		{"new player draws", Default(), Default(), Draw, 1500, 290.32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Update(tt.player, tt.opponent, tt.score)
+			if !near(got.Rating, tt.rating, 0.01) || !near(got.Deviation, tt.deviation, 0.01) {
+				t.Fatalf("Update = %+v, want rating %.2f, deviation %.2f", got, tt.rating, tt.deviation)
+			}
+		})
+	}
+}
+
+func TestUpdateMovesTowardsResult(t *testing.T) {
+	strong := Rating{Rating: 1800, Deviation: 80, Volatility: DefaultVolatility}
+	weak := Rating{Rating: 1400, Deviation: 80, Volatility: DefaultVolatility}
+
+	expectedWin := Update(strong, weak, Win)
+	upset := Update(weak, strong, Win)
+	if gain, upsetGain := expectedWin.Rating-strong.Rating, upset.Rating-weak.Rating; gain <= 0 || upsetGain <= gain {
+		t.Fatalf("expected win gained %.2f and upset gained %.2f, want an upset to gain more", gain, upsetGain)
+	}
+	if loss := Update(strong, weak, Loss); loss.Rating >= strong.Rating {
+		t.Fatalf("losing to a weaker player raised the rating to %.2f", loss.Rating)
+	}
+}
+
+func TestUpdatePeriodWithoutGames(t *testing.T) {
+	player := Rating{Rating: 1700, Deviation: 50, Volatility: DefaultVolatility}
+	got := UpdatePeriod(player, nil)
+	if got.Rating != player.Rating || got.Volatility != player.Volatility || got.Deviation <= player.Deviation {
+		t.Fatalf("UpdatePeriod without games = %+v, want only a wider deviation than %+v", got, player)
+	}
+	if capped := UpdatePeriod(Default(), nil); capped.Deviation != DefaultDeviation {
+		t.Fatalf("deviation grew to %.2f, want it capped at %d", capped.Deviation, DefaultDeviation)
+	}
+}
+
+func TestConservative(t *testing.T) {
+	r := Rating{Rating: 1600, Deviation: 100}
+	if got := r.Conservative(); got != 1400 {
+		t.Fatalf("Conservative() = %.2f, want 1400", got)
+	}
+}
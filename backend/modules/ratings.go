@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"math"
+
+	"nakama-arena/modules/rating"
+)
+
+// conservativeRatingSQL orders players by rating.Rating.Conservative
+const conservativeRatingSQL = "(rating - 2 * rating_deviation)"
+
+// ratedPlayer is a player's standing after a rated match
+type ratedPlayer struct {
+	UserID   string
+	Username string
+	Result   float64 // rating.Loss, rating.Draw or rating.Win
+	Rating   rating.Rating
+	Wins     int // this season
+	Losses   int
+	Draws    int
+}
+
+// rateMatch updates both players' records and Glicko-2 ratings for a finished
+// PvP series inside tx, adds their rating history and audit rows and returns
+// the players it rated. winnerID is empty for a draw. Players without a
+// player_stats row are not rated.
+func rateMatch(ctx context.Context, tx *sql.Tx, matchID, player1ID, player2ID, winnerID string) ([]ratedPlayer, error) {
+	// Lock both rows in a fixed order so concurrent matches cannot deadlock
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, username, rating, rating_deviation, rating_volatility
+		FROM player_stats
+		WHERE user_id IN ($1, $2)
+		ORDER BY user_id
+		FOR UPDATE
+	`, player1ID, player2ID)
+	if err != nil {
+		return nil, err
+	}
+	ratings := map[string]rating.Rating{player1ID: rating.Default(), player2ID: rating.Default()}
+	usernames := make(map[string]string)
+	for rows.Next() {
+		var userID, username string
+		var r rating.Rating
+		if err := rows.Scan(&userID, &username, &r.Rating, &r.Deviation, &r.Volatility); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ratings[userID] = r
+		usernames[userID] = username
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var rated []ratedPlayer
+
+	for _, pair := range [2][2]string{{player1ID, player2ID}, {player2ID, player1ID}} {
+		userID, opponentID := pair[0], pair[1]
+		username, found := usernames[userID]
+		if !found {
+			continue
+		}
+
+		result, column := rating.Loss, "losses"
+		switch winnerID {
+		case "":
+			result, column = rating.Draw, "draws"
+		case userID:
+			result, column = rating.Win, "wins"
+		}
+		before := ratings[userID]
+		after := rating.Update(before, ratings[opponentID], result)
+
+		// Score mirrors the conservative rating for clients that show it
+		player := ratedPlayer{UserID: userID, Username: username, Result: result, Rating: after}
+		err := tx.QueryRowContext(ctx, `
+			UPDATE player_stats
+			SET `+column+` = `+column+` + 1, season_`+column+` = season_`+column+` + 1, rating = $2, rating_deviation = $3, rating_volatility = $4, score = $5, updated_at = NOW()
+			WHERE user_id = $1
+			RETURNING season_wins, season_losses, season_draws
+		`, userID, after.Rating, after.Deviation, after.Volatility, int(math.Round(after.Conservative()))).Scan(&player.Wins, &player.Losses, &player.Draws)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO rating_history (user_id, match_id, opponent_id, result, rating_before, rating, rating_deviation, rating_volatility)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, userID, matchID, opponentID, result, before.Rating, after.Rating, after.Deviation, after.Volatility)
+		if err != nil {
+			return nil, err
+		}
+		err = auditStatChange(ctx, tx, userID, StatSourceMatch, matchID, map[string]interface{}{
+			"column":        column,
+			"change":        1,
+			"rating_before": before,
+			"rating_after":  after,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rated = append(rated, player)
+	}
+	return rated, nil
+}
+
+// countMatch adds an unrated PvP series to both players' all-time records
+// inside tx and audits the change. winnerID is empty for a draw.
+func countMatch(ctx context.Context, tx *sql.Tx, matchID, player1ID, player2ID, winnerID string) error {
+	for _, userID := range []string{player1ID, player2ID} {
+		column := "losses"
+		switch winnerID {
+		case "":
+			column = "draws"
+		case userID:
+			column = "wins"
+		}
+		result, err := tx.ExecContext(ctx, `UPDATE player_stats SET `+column+` = `+column+` + 1, updated_at = NOW() WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		// Players without a player_stats row are not counted
+		if updated == 0 {
+			continue
+		}
+		err = auditStatChange(ctx, tx, userID, StatSourceMatch, matchID, map[string]interface{}{
+			"column": column,
+			"change": 1,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
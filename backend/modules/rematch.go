@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/game"
+)
+
+const (
+	// DefaultRematchWindowSec is how long players have to agree on a rematch
+	// once a match is complete before it closes
+	DefaultRematchWindowSec = 30
+)
+
+// openRematchWindow starts the countdown for a rematch after the series ends.
+// The bot is always willing to play again.
+func (s *TicTacToeState) openRematchWindow(now time.Time) {
+	s.RematchOffers = make(map[string]bool)
+	if s.RematchWindowMs <= 0 {
+		return
+	}
+	s.RematchDeadline = now.Add(time.Duration(s.RematchWindowMs) * time.Millisecond)
+	if s.BotMatch {
+		s.RematchOffers["bot"] = true
+	}
+}
+
+// rematchOpen reports whether players may still offer or accept a rematch
+func (s *TicTacToeState) rematchOpen(now time.Time) bool {
+	return s.MatchState == MatchStateComplete && !s.RematchDeadline.IsZero() && now.Before(s.RematchDeadline)
+}
+
+// rematchMessage reports who wants a rematch and how long is left to accept
+func (s *TicTacToeState) rematchMessage(now time.Time) rematchMessage {
+	message := rematchMessage{
+		Offers:           make([]string, 0, len(s.RematchOffers)),
+		SecondsRemaining: (max(s.RematchDeadline.Sub(now).Milliseconds(), 0) + 999) / 1000,
+	}
+	for playerID := range s.RematchOffers {
+		message.Offers = append(message.Offers, playerID)
+	}
+	sort.Strings(message.Offers)
+	return message
+}
+
+// offerRematch records that userID wants to play again and starts a new match
+// once every player has agreed. Accepting requires a pending offer from the
+// opponent.
+func (m *TicTacToeMatch) offerRematch(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState, userID string, accept bool) error {
+	if _, ok := s.Players[userID]; !ok {
+		if _, spectating := s.Spectators[userID]; spectating {
+			return errSpectator
+		}
+		return errNotAPlayer
+	}
+	now := time.Now()
+	if !s.rematchOpen(now) {
+		return errRematchUnavailable
+	}
+	if accept && len(s.RematchOffers) == 0 {
+		return errNoRematchOffer
+	}
+
+	s.RematchOffers[userID] = true
+	if len(s.RematchOffers) < len(s.Players) {
+		m.broadcast(dispatcher, s, OpCodeRematchOffered, s.rematchMessage(now), nil)
+		return nil
+	}
+
+	m.startRematch(ctx, dispatcher, s)
+	return nil
+}
+
+// startRematch resets the series and starts a new one with marks swapped
+func (m *TicTacToeMatch) startRematch(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState) {
+	s.Round = 0
+	s.SeriesScore = make(map[string]int)
+	s.Games = nil
+	s.SeriesWinner = ""
+	s.RematchOffers = make(map[string]bool)
+	s.RematchDeadline = time.Time{}
+	s.Winner = game.InProgress
+
+	m.startNextGame(ctx, dispatcher, s)
+}
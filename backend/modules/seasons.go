@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/rating"
+)
+
+const (
+	// SeasonCheckInterval is how often each node checks whether the current
+	// season has ended
+	SeasonCheckInterval = time.Minute
+
+	// SeasonRatingCarryOver is the share of a rating's distance from the
+	// default that survives a season reset
+	SeasonRatingCarryOver = 0.5
+	// SeasonResetDeviation is the least deviation a rating has after a reset,
+	// so it settles again quickly in the new season
+	SeasonResetDeviation = 200
+
+	// SeasonPodiumSize is how many top players the default reward hook notifies
+	SeasonPodiumSize = 3
+	// NotificationCodeSeasonReward tags season reward notifications
+	NotificationCodeSeasonReward = 100
+
+	// maxSeasonStandings caps the standings returned by one request
+	maxSeasonStandings = 100
+)
+
+// season is a competitive period; operators may schedule seasons by inserting
+// rows into the seasons table, otherwise they are created back to back
+type season struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// seasonStanding is a player's final place in an archived season
+type seasonStanding struct {
+	UserID             string  `json:"user_id"`
+	Username           string  `json:"username"`
+	Rank               int     `json:"rank"`
+	Rating             float64 `json:"rating"`
+	Deviation          float64 `json:"deviation"`
+	ConservativeRating float64 `json:"conservative_rating"`
+	Wins               int     `json:"wins"`
+	Losses             int     `json:"losses"`
+	Draws              int     `json:"draws"`
+}
+
+// SeasonRewardHook is called once a season's standings have been archived
+type SeasonRewardHook func(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, s season, standings []seasonStanding) error
+
+// seasonRewardHooks run in order after every season ends
+var seasonRewardHooks = []SeasonRewardHook{notifySeasonPodium}
+
+// nextSeasonAfter returns the automatic season starting at start. Seasons last
+// SEASON_LENGTH_DAYS days when set, otherwise a calendar month.
+func nextSeasonAfter(start time.Time) season {
+	start = start.UTC()
+	if days, err := strconv.Atoi(os.Getenv("SEASON_LENGTH_DAYS")); err == nil && days > 0 {
+		return season{
+			ID:       start.Format("2006-01-02"),
+			Name:     "Season of " + start.Format("2 January 2006"),
+			StartsAt: start,
+			EndsAt:   start.AddDate(0, 0, days),
+		}
+	}
+	monthStart := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return season{
+		ID:       start.Format("2006-01"),
+		Name:     start.Format("January 2006") + " Season",
+		StartsAt: start,
+		EndsAt:   monthStart.AddDate(0, 1, 0),
+	}
+}
+
+// openSeason returns the earliest season that has not been closed
+func openSeason(ctx context.Context, db *sql.DB) (season, error) {
+	var s season
+	err := db.QueryRowContext(ctx, `
+		SELECT id, name, starts_at, ends_at
+		FROM seasons
+		WHERE closed_at IS NULL
+		ORDER BY starts_at
+		LIMIT 1
+	`).Scan(&s.ID, &s.Name, &s.StartsAt, &s.EndsAt)
+	return s, err
+}
+
+// currentSeason returns the open season, creating the next automatic one when
+// none is scheduled
+func currentSeason(ctx context.Context, db *sql.DB) (season, error) {
+	s, err := openSeason(ctx, db)
+	if err != sql.ErrNoRows {
+		return s, err
+	}
+
+	// Follow on from the last closed season, or start one now
+	start := time.Now()
+	var lastEnd sql.NullTime
+	if err := db.QueryRowContext(ctx, `SELECT MAX(ends_at) FROM seasons`).Scan(&lastEnd); err != nil {
+		return s, err
+	}
+	if lastEnd.Valid && lastEnd.Time.After(start) {
+		start = lastEnd.Time
+	}
+	next := nextSeasonAfter(start)
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO seasons (id, name, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+	`, next.ID, next.Name, next.StartsAt, next.EndsAt)
+	if err != nil {
+		return s, err
+	}
+
+	// Another node may have created it first; a closed season with the same
+	// id means the schedule needs an operator
+	s, err = openSeason(ctx, db)
+	if err == sql.ErrNoRows {
+		return s, fmt.Errorf("season %s is already closed", next.ID)
+	}
+	return s, err
+}
+
+// runSeasonScheduler ends seasons as they expire until ctx is cancelled
+func runSeasonScheduler(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) {
+	ticker := time.NewTicker(SeasonCheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := endExpiredSeason(ctx, logger, db, nk); err != nil {
+			logger.Error("Error ending season: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// endExpiredSeason archives the standings of the current season if it has
+// ended, softly resets ratings and season records, and runs the reward
+// hooks. The season row is locked so only one node ends it.
+func endExpiredSeason(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule) error {
+	current, err := currentSeason(ctx, db)
+	if err != nil || time.Now().Before(current.EndsAt) {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM seasons WHERE id = $1 AND closed_at IS NULL FOR UPDATE SKIP LOCKED`, current.ID).Scan(&id)
+	if err == sql.ErrNoRows {
+		// Another node is ending or has ended it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Archive everyone who played a rated game this season
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO season_standings (season_id, user_id, username, rank, rating, rating_deviation, conservative_rating, wins, losses, draws)
+		SELECT $1, user_id, username, RANK() OVER (ORDER BY `+conservativeRatingSQL+` DESC),
+			rating, rating_deviation, `+conservativeRatingSQL+`, season_wins, season_losses, season_draws
+		FROM player_stats
+		WHERE season_wins + season_losses + season_draws > 0
+		ON CONFLICT (season_id, user_id) DO NOTHING
+	`, current.ID)
+	if err != nil {
+		return err
+	}
+
+	// Pull ratings towards the default and make them less certain
+	_, err = tx.ExecContext(ctx, `
+		UPDATE player_stats
+		SET rating = $1 + (rating - $1) * $2,
+			rating_deviation = GREATEST(rating_deviation, $3),
+			season_wins = 0, season_losses = 0, season_draws = 0,
+			updated_at = NOW()
+	`, rating.DefaultRating, SeasonRatingCarryOver, SeasonResetDeviation)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE player_stats SET score = ROUND(`+conservativeRatingSQL+`)`); err != nil {
+		return err
+	}
+	err = auditStatChange(ctx, tx, "", StatSourceSeasonReset, "", map[string]interface{}{
+		"season_id":         current.ID,
+		"rating_carry_over": SeasonRatingCarryOver,
+		"min_deviation":     SeasonResetDeviation,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE seasons SET closed_at = NOW() WHERE id = $1`, current.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info("Season %s ended", current.ID)
+	if err := resetRatingLeaderboard(ctx, nk); err != nil {
+		logger.Error("Error resetting %s leaderboard: %v", LeaderboardRating, err)
+	}
+
+	standings, err := seasonStandings(ctx, db, current.ID, maxSeasonStandings)
+	if err != nil {
+		return err
+	}
+	for _, hook := range seasonRewardHooks {
+		if err := hook(ctx, logger, db, nk, current, standings); err != nil {
+			logger.Error("Season %s reward hook failed: %v", current.ID, err)
+		}
+	}
+	return nil
+}
+
+// seasonStandings returns the top archived standings of a season
+func seasonStandings(ctx context.Context, db *sql.DB, seasonID string, limit int) ([]seasonStanding, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT user_id, username, rank, rating, rating_deviation, conservative_rating, wins, losses, draws
+		FROM season_standings
+		WHERE season_id = $1
+		ORDER BY rank, username
+		LIMIT $2
+	`, seasonID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	standings := []seasonStanding{}
+	for rows.Next() {
+		var st seasonStanding
+		if err := rows.Scan(&st.UserID, &st.Username, &st.Rank, &st.Rating, &st.Deviation, &st.ConservativeRating, &st.Wins, &st.Losses, &st.Draws); err != nil {
+			return nil, err
+		}
+		standings = append(standings, st)
+	}
+	return standings, rows.Err()
+}
+
+// notifySeasonPodium tells the top players of a season where they finished
+func notifySeasonPodium(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, s season, standings []seasonStanding) error {
+	for _, st := range standings {
+		if st.Rank > SeasonPodiumSize {
+			break
+		}
+		content := map[string]interface{}{
+			"season_id":   s.ID,
+			"season_name": s.Name,
+			"rank":        st.Rank,
+			"rating":      st.Rating,
+		}
+		if err := nk.NotificationSend(ctx, st.UserID, s.Name+" finished", content, NotificationCodeSeasonReward, "", true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rpcGetSeason returns the current season
+func rpcGetSeason(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	s, err := currentSeason(ctx, db)
+	if err != nil {
+		logger.Error("Error reading current season: %v", err)
+		return "", runtime.NewError("Error retrieving season", 500)
+	}
+
+	response := map[string]interface{}{
+		"season":            s,
+		"seconds_remaining": max(int64(time.Until(s.EndsAt).Seconds()), 0),
+	}
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		logger.Error("Error marshaling result: %v", err)
+		return "", runtime.NewError("Error processing season", 500)
+	}
+	return string(jsonResponse), nil
+}
+
+// rpcGetSeasonStandings returns the archived final standings of a season
+func rpcGetSeasonStandings(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, payload string) (string, error) {
+	var input struct {
+		SeasonID string `json:"season_id"`
+		Limit    int    `json:"limit"`
+	}
+
+	if err := json.Unmarshal([]byte(payload), &input); err != nil || input.SeasonID == "" {
+		return "", runtime.NewError("season_id is required", 400)
+	}
+	if input.Limit <= 0 || input.Limit > maxSeasonStandings {
+		input.Limit = maxSeasonStandings
+	}
+
+	var s season
+	var closedAt sql.NullTime
+	err := db.QueryRowContext(ctx, `SELECT id, name, starts_at, ends_at, closed_at FROM seasons WHERE id = $1`, input.SeasonID).Scan(&s.ID, &s.Name, &s.StartsAt, &s.EndsAt, &closedAt)
+	if err == sql.ErrNoRows {
+		return "", runtime.NewError("Season not found", 404)
+	}
+	if err != nil {
+		logger.Error("Error reading season: %v", err)
+		return "", runtime.NewError("Error retrieving season", 500)
+	}
+	if !closedAt.Valid {
+		return "", runtime.NewError("Season has not ended yet", 400)
+	}
+
+	standings, err := seasonStandings(ctx, db, s.ID, input.Limit)
+	if err != nil {
+		logger.Error("Error reading season standings: %v", err)
+		return "", runtime.NewError("Error retrieving season standings", 500)
+	}
+
+	jsonResponse, err := json.Marshal(map[string]interface{}{"season": s, "standings": standings})
+	if err != nil {
+		logger.Error("Error marshaling result: %v", err)
+		return "", runtime.NewError("Error processing season standings", 500)
+	}
+	return string(jsonResponse), nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/game"
+)
+
+const (
+	// MaxBestOf is the longest series a match can host
+	MaxBestOf = 9
+
+	// SeriesIntermission is the pause between games of a series
+	SeriesIntermission = 3 * time.Second
+)
+
+// gameRecord is the per-game detail kept for a series
+type gameRecord struct {
+	Round   int          `json:"round"`
+	X       string       `json:"x"` // user ID that played X and moved first
+	O       string       `json:"o"`
+	Outcome game.Outcome `json:"outcome"`
+	Winner  string       `json:"winner,omitempty"`
+	Reason  string       `json:"reason"`
+	Board   game.Board   `json:"board"`
+}
+
+// seriesActive reports whether a series is being played, including the pause
+// between its games
+func (s *TicTacToeState) seriesActive() bool {
+	return s.MatchState == MatchStateInProgress || s.MatchState == MatchStateBetweenGames
+}
+
+// seriesDecided reports whether a player has clinched the series or every game
+// has been played
+func (s *TicTacToeState) seriesDecided() bool {
+	needed := s.BestOf/2 + 1
+	for _, wins := range s.SeriesScore {
+		if wins >= needed {
+			return true
+		}
+	}
+	return len(s.Games) >= s.BestOf
+}
+
+// seriesLeader returns the player with the most game wins, or "" when tied
+func (s *TicTacToeState) seriesLeader() string {
+	leader, best, tied := "", -1, false
+	for playerID := range s.Players {
+		wins := s.SeriesScore[playerID]
+		switch {
+		case wins > best:
+			leader, best, tied = playerID, wins, false
+		case wins == best:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return leader
+}
+
+// startNextGame clears the board, swaps marks so the other player moves first
+// and starts the next game of the series
+func (m *TicTacToeMatch) startNextGame(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState) {
+	board, err := game.NewBoard(s.Board.Size, s.Board.WinLength)
+	if err != nil {
+		m.logger.Error("Error creating board for next game: %v", err)
+		return
+	}
+
+	now := time.Now()
+	s.Round++
+	s.Board = board
+	s.CurrentTurn = game.X
+	s.Winner = game.InProgress
+	for playerID, mark := range s.Players {
+		s.Players[playerID] = mark.Opponent()
+	}
+	s.MatchState = MatchStateInProgress
+	s.LastMoveTime = now
+	s.startClocks(now)
+
+	message := statusMessage{Message: "Game started"}
+	if s.BestOf > 1 {
+		message.Message = fmt.Sprintf("Game %d of %d started", s.Round, s.BestOf)
+	}
+	m.broadcast(dispatcher, s, OpCodeGameStarted, message, nil)
+	m.sendSnapshot(dispatcher, s, s.presenceList())
+
+	m.scheduleBotMove(s)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+// Commands accepted by TicTacToeMatch.MatchSignal
+const (
+	SignalJoin  = "join"  // seat user_id as a player without a socket presence
+	SignalMove  = "move"  // play row/col (or index) for user_id
+	SignalAbort = "abort" // end a running series as a draw; sent by abort_match
+)
+
+// signalMaxAge bounds how long a signed command may wait before it is applied
+const signalMaxAge = 30 * time.Second
+
+// Errors returned for signal commands that cannot be applied
+var (
+	errBadSignature   = errors.New("bad signature")
+	errSignalExpired  = errors.New("signal expired")
+	errUnknownCommand = errors.New("unknown command")
+	errMatchFull      = errors.New("match is full")
+	errMatchReserved  = errors.New("match is reserved for other players")
+)
+
+// signalKey signs commands passed from RPCs to matches. Set MATCH_SIGNAL_KEY
+// to share it across nodes; otherwise each process generates its own.
+var signalKey = loadSignalKey()
+
+func loadSignalKey() []byte {
+	if key := os.Getenv("MATCH_SIGNAL_KEY"); key != "" {
+		return []byte(key)
+	}
+	key := make([]byte, 32)
+	if _, err := cryptorand.Read(key); err != nil {
+		panic("unable to generate match signal key: " + err.Error())
+	}
+	return key
+}
+
+// signalCommand is the signed body of a match signal
+type signalCommand struct {
+	Command  string `json:"command"`
+	UserID   string `json:"user_id,omitempty"`
+	Row      *int   `json:"row,omitempty"`
+	Col      *int   `json:"col,omitempty"`
+	Index    *int   `json:"index,omitempty"` // row-major alternative to row/col
+	IssuedAt int64  `json:"issued_at"`       // Unix milliseconds
+}
+
+// signedSignal is the envelope passed to nk.MatchSignal
+type signedSignal struct {
+	Payload   json.RawMessage `json:"payload"`
+	Signature string          `json:"signature"` // hex HMAC-SHA256 of Payload
+}
+
+// signalResult is returned to the caller of nk.MatchSignal
+type signalResult struct {
+	Accepted    bool         `json:"accepted"`
+	Code        string       `json:"code,omitempty"`
+	Reason      string       `json:"reason,omitempty"`
+	Mark        game.Mark    `json:"mark,omitempty"` // mark played by the command's user
+	Board       game.Board   `json:"board"`
+	CurrentTurn game.Mark    `json:"current_turn"`
+	Winner      game.Outcome `json:"winner"`
+	MatchState  int          `json:"match_state"`
+}
+
+// signSignal stamps and signs a command for nk.MatchSignal
+func signSignal(cmd signalCommand) (string, error) {
+	cmd.IssuedAt = time.Now().UnixMilli()
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, signalKey)
+	mac.Write(payload)
+	data, err := json.Marshal(signedSignal{Payload: payload, Signature: hex.EncodeToString(mac.Sum(nil))})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// verifySignal checks the signature and age of a signal and decodes it
+func verifySignal(data string, now time.Time) (signalCommand, error) {
+	var cmd signalCommand
+	var envelope signedSignal
+	if err := json.Unmarshal([]byte(data), &envelope); err != nil {
+		return cmd, errInvalidPayload
+	}
+	signature, err := hex.DecodeString(envelope.Signature)
+	if err != nil {
+		return cmd, errBadSignature
+	}
+	mac := hmac.New(sha256.New, signalKey)
+	mac.Write(envelope.Payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return cmd, errBadSignature
+	}
+	if err := json.Unmarshal(envelope.Payload, &cmd); err != nil {
+		return cmd, errInvalidPayload
+	}
+	if now.Sub(time.UnixMilli(cmd.IssuedAt)) > signalMaxAge {
+		return cmd, errSignalExpired
+	}
+	return cmd, nil
+}
+
+// move resolves the command's target cell on a board of the given size
+func (c signalCommand) move(size int) (game.Move, error) {
+	if c.Row != nil && c.Col != nil {
+		return game.Move{Row: *c.Row, Col: *c.Col}, nil
+	}
+	if c.Index != nil {
+		return game.MoveFromIndex(*c.Index, size)
+	}
+	return game.Move{}, errInvalidPayload
+}
+
+// newSignalResult reports the outcome of a command along with the board after it
+func newSignalResult(s *TicTacToeState, userID string, err error) string {
+	result := signalResult{
+		Accepted:    err == nil,
+		Mark:        s.Players[userID],
+		Board:       s.Board,
+		CurrentTurn: s.CurrentTurn,
+		Winner:      s.Winner,
+		MatchState:  s.MatchState,
+	}
+	if err != nil {
+		rejection := newRejection(0, err)
+		result.Code = rejection.Code
+		result.Reason = rejection.Message
+	}
+	resultJSON, _ := json.Marshal(result)
+	return string(resultJSON)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+// envelope wraps payload with the given signature
+func envelope(t *testing.T, payload, signature string) string {
+	t.Helper()
+	data, err := json.Marshal(signedSignal{Payload: json.RawMessage(payload), Signature: signature})
+	if err != nil {
+		t.Fatalf("marshal envelope: %v", err)
+	}
+	return string(data)
+}
+
+// signWith signs payload with key the same way signSignal does
+func signWith(key []byte, payload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// intPtr returns a pointer to v
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestSignSignalRoundTrip(t *testing.T) {
+	cmd := signalCommand{Command: SignalMove, UserID: "u1", Row: intPtr(1), Col: intPtr(2), IssuedAt: 1}
+	data, err := signSignal(cmd)
+	if err != nil {
+		t.Fatalf("signSignal: %v", err)
+	}
+	got, err := verifySignal(data, time.Now())
+	if err != nil {
+		t.Fatalf("verifySignal: %v", err)
+	}
+	if got.Command != cmd.Command || got.UserID != cmd.UserID || *got.Row != 1 || *got.Col != 2 || got.Index != nil {
+		t.Errorf("verifySignal = %+v, want %+v", got, cmd)
+	}
+	if time.Since(time.UnixMilli(got.IssuedAt)) > time.Second {
+		t.Errorf("signSignal kept issued_at %d instead of stamping the current time", got.IssuedAt)
+	}
+}
+
+func TestVerifySignal(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	payload := func(issuedAt time.Time) string {
+		return `{"command":"move","user_id":"u1","index":4,"issued_at":` + strconv.FormatInt(issuedAt.UnixMilli(), 10) + `}`
+	}
+	fresh := payload(now.Add(-time.Second))
+	oldest := payload(now.Add(-signalMaxAge))
+	expired := payload(now.Add(-signalMaxAge - time.Millisecond))
+	tampered := strings.Replace(fresh, `"u1"`, `"u2"`, 1)
+	signature := signWith(signalKey, fresh)
+
+	tests := []struct {
+		name string
+		data string
+		err  error
+	}{
+		{"valid", envelope(t, fresh, signature), nil},
+		{"uppercase hex", envelope(t, fresh, strings.ToUpper(signature)), nil},
+		{"at the max age", envelope(t, oldest, signWith(signalKey, oldest)), nil},
+		{"tampered payload", envelope(t, tampered, signature), errBadSignature},
+		{"signed with another key", envelope(t, fresh, signWith([]byte("other key"), fresh)), errBadSignature},
+		{"signature is not hex", envelope(t, fresh, "zz"+signature[2:]), errBadSignature},
+		{"odd-length signature", envelope(t, fresh, signature[1:]), errBadSignature},
+		{"truncated signature", envelope(t, fresh, signature[:32]), errBadSignature},
+		{"missing signature", envelope(t, fresh, ""), errBadSignature},
+		{"expired", envelope(t, expired, signWith(signalKey, expired)), errSignalExpired},
+		{"never stamped", envelope(t, `{"command":"move"}`, signWith(signalKey, `{"command":"move"}`)), errSignalExpired},
+		{"envelope is not JSON", "not json", errInvalidPayload},
+		{"signed payload is not an object", envelope(t, `"move"`, signWith(signalKey, `"move"`)), errInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := verifySignal(tt.data, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("verifySignal error = %v, want %v", err, tt.err)
+			}
+			if err == nil && (cmd.Command != SignalMove || cmd.UserID != "u1") {
+				t.Errorf("verifySignal = %+v, want a move for u1", cmd)
+			}
+		})
+	}
+}
+
+func TestSignalCommandMove(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  signalCommand
+		size int
+		want game.Move
+		err  error
+	}{
+		{"row and col", signalCommand{Row: intPtr(2), Col: intPtr(0)}, 3, game.Move{Row: 2, Col: 0}, nil},
+		{"index", signalCommand{Index: intPtr(5)}, 3, game.Move{Row: 1, Col: 2}, nil},
+		{"index on a larger board", signalCommand{Index: intPtr(17)}, 15, game.Move{Row: 1, Col: 2}, nil},
+		{"row and col win over index", signalCommand{Row: intPtr(0), Col: intPtr(1), Index: intPtr(8)}, 3, game.Move{Row: 0, Col: 1}, nil},
+		{"row without col falls back to index", signalCommand{Row: intPtr(0), Index: intPtr(8)}, 3, game.Move{Row: 2, Col: 2}, nil},
+		{"zero index", signalCommand{Index: intPtr(0)}, 3, game.Move{}, nil},
+		{"index past the board", signalCommand{Index: intPtr(9)}, 3, game.Move{}, game.ErrOutOfBounds},
+		{"negative index", signalCommand{Index: intPtr(-1)}, 3, game.Move{}, game.ErrOutOfBounds},
+		{"row only", signalCommand{Row: intPtr(1)}, 3, game.Move{}, errInvalidPayload},
+		{"no target", signalCommand{}, 3, game.Move{}, errInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cmd.move(tt.size)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("move(%d) = %+v, %v, want %+v, %v", tt.size, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
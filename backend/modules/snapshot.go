@@ -0,0 +1,79 @@
+package main
+
+import (
+	"time"
+
+	"nakama-arena/modules/game"
+)
+
+// stateSnapshot is the public view of TicTacToeState sent to clients so they
+// can redraw a game from scratch. Server bookkeeping such as presence flags and
+// raw timestamps is left out.
+type stateSnapshot struct {
+	ProtocolVersion         int                  `json:"protocol_version"` // Version negotiated with the recipient
+	Spectator               bool                 `json:"spectator"`        // Whether the recipient is a read-only viewer
+	SpectatorCount          int                  `json:"spectator_count"`
+	Board                   game.Board           `json:"board"`
+	CurrentTurn             game.Mark            `json:"current_turn"`
+	Winner                  game.Outcome         `json:"winner"`
+	Players                 map[string]game.Mark `json:"players"`
+	MatchState              int                  `json:"match_state"`
+	BotMatch                bool                 `json:"bot_match"`
+	MoveTimeMs              int64                `json:"move_time_ms"`
+	GameTimeMs              int64                `json:"game_time_ms"`
+	IncrementMs             int64                `json:"increment_ms"`
+	MoveRemainingMs         int64                `json:"move_remaining_ms"` // -1 when no move clock is running
+	Clocks                  map[string]int64     `json:"clocks"`
+	Disconnected            map[string]int64     `json:"disconnected"` // Map of user ID to seconds left to return
+	BestOf                  int                  `json:"best_of"`
+	Round                   int                  `json:"round"`
+	SeriesScore             map[string]int       `json:"series_score"`             // Map of user ID to games won
+	RematchOffers           []string             `json:"rematch_offers,omitempty"` // User IDs that want a rematch
+	RematchSecondsRemaining int64                `json:"rematch_seconds_remaining,omitempty"`
+	BotLevel                int                  `json:"bot_level,omitempty"` // Numbered bot level in bot matches
+}
+
+// snapshot captures the current state as seen at now
+func (s *TicTacToeState) snapshot(now time.Time) stateSnapshot {
+	snap := stateSnapshot{
+		Board:           s.Board,
+		CurrentTurn:     s.CurrentTurn,
+		Winner:          s.Winner,
+		Players:         s.Players,
+		MatchState:      s.MatchState,
+		BotMatch:        s.BotMatch,
+		SpectatorCount:  s.spectatorCount(),
+		MoveTimeMs:      s.MoveTimeMs,
+		GameTimeMs:      s.GameTimeMs,
+		IncrementMs:     s.IncrementMs,
+		MoveRemainingMs: -1,
+		Clocks:          make(map[string]int64, len(s.Clocks)),
+		Disconnected:    make(map[string]int64, len(s.DisconnectedAt)),
+		BestOf:          s.BestOf,
+		Round:           s.Round,
+		SeriesScore:     s.SeriesScore,
+		BotLevel:        s.BotLevel,
+	}
+
+	for playerID, remaining := range s.Clocks {
+		snap.Clocks[playerID] = remaining
+	}
+	if s.MatchState == MatchStateInProgress && s.clocked() {
+		clock := s.clockMessage(now)
+		snap.MoveRemainingMs = clock.MoveRemainingMs
+		snap.Clocks = clock.Clocks
+	}
+
+	if s.rematchOpen(now) {
+		rematch := s.rematchMessage(now)
+		snap.RematchOffers = rematch.Offers
+		snap.RematchSecondsRemaining = rematch.SecondsRemaining
+	}
+
+	for userID, leftAt := range s.DisconnectedAt {
+		remaining := s.ReconnectWindowMs - now.Sub(leftAt).Milliseconds()
+		snap.Disconnected[userID] = (max(remaining, 0) + 999) / 1000
+	}
+
+	return snap
+}
@@ -5,38 +5,163 @@ import (
 	"database/sql"
 	"encoding/json"
 	"math/rand"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/heroiclabs/nakama-common/runtime"
+
+	"nakama-arena/modules/bot"
+	"nakama-arena/modules/game"
 )
 
 const (
+	// DefaultReconnectWindowSec is how long a dropped player has to rejoin
+	DefaultReconnectWindowSec = 30
+	
+	// MaxSpectators caps read-only presences per match
+	MaxSpectators = 100
+	
 	// Match states
 	MatchStateInit      = 0
 	MatchStateReady     = 1
 	MatchStateInProgress = 2
 	MatchStateComplete  = 3
-	
-	// Board size
-	BoardSize = 3
-	
-	// Player marks
-	MarkEmpty = 0
-	MarkX     = 1
-	MarkO     = 2
+	MatchStateBetweenGames = 4 // A series game has ended and the next one is about to start
 )
 
 // TicTacToeState represents the game state
 type TicTacToeState struct {
-	Board       [][]int          `json:"board"`
-	CurrentTurn int              `json:"current_turn"` // 1 for X, 2 for O
-	Winner      int              `json:"winner"`       // 0 for no winner yet, 1 for X, 2 for O, 3 for draw
-	Players     map[string]int   `json:"players"`      // Map of user ID to player mark
+	Board       game.Board       `json:"board"`
+	CurrentTurn game.Mark        `json:"current_turn"` // 1 for X, 2 for O
+	Winner      game.Outcome     `json:"winner"`       // 0 for no winner yet, 1 for X, 2 for O, 3 for draw
+	Players     map[string]game.Mark `json:"players"`  // Map of user ID to player mark
 	Presences   map[string]bool  `json:"presences"`    // Map of user ID to presence status
+	Spectators  map[string]bool  `json:"spectators"`   // Map of user ID to presence status for read-only viewers
 	MatchState  int              `json:"match_state"`
 	BotMatch    bool             `json:"bot_match"`
 	BotDifficulty string         `json:"bot_difficulty"`
+	BotStrategy   string         `json:"bot_strategy"`       // Registered bot.Strategy name, defaults to the difficulty
+	BotSkill      float64        `json:"bot_skill"`          // Adaptive bots only; tracks the player's level between games
+	BotLevel      int            `json:"bot_level"`          // Numbered level being played, 0 if the strategy is not a level
+	BotDelay      botDelay       `json:"bot_delay"`          // Simulated thinking time range
+	BotMark       game.Mark      `json:"bot_mark"`           // Mark the bot plays in the first game
+	BotMoveDueTick int64         `json:"bot_move_due_tick"` // Tick at which the scheduled bot move is played, 0 if none
+	Tick          int64          `json:"tick"`              // Tick of the callback currently running
 	LastMoveTime time.Time       `json:"last_move_time"`
+	Reserved     []string        `json:"reserved"`           // User IDs the seats are held for, empty if anyone may take a seat
+	Ranked       bool            `json:"ranked"`             // Created by ranked matchmaking
+	
+	// Time control; zero values disable the corresponding clock
+	MoveTimeMs    int64            `json:"move_time_ms"`    // Limit for a single move
+	GameTimeMs    int64            `json:"game_time_ms"`    // Total time bank per player
+	IncrementMs   int64            `json:"increment_ms"`    // Fischer increment added after each move
+	Clocks        map[string]int64 `json:"clocks"`          // Remaining game time per user ID
+	TurnStartedAt time.Time        `json:"turn_started_at"`
+	
+	// Reconnection; players who drop mid-game forfeit only once the window expires
+	ReconnectWindowMs int64                `json:"reconnect_window_ms"`
+	DisconnectedAt    map[string]time.Time `json:"disconnected_at"` // Map of user ID to when they dropped
+	
+	// Series; the match hosts up to BestOf games and marks swap every round
+	BestOf       int            `json:"best_of"`
+	Round        int            `json:"round"`
+	SeriesScore  map[string]int `json:"series_score"` // Map of user ID to games won
+	Games        []gameRecord   `json:"games"`
+	SeriesWinner string         `json:"series_winner"` // Empty while running or for a drawn series
+	NextGameAt   time.Time      `json:"next_game_at"`
+	
+	// Rematch; once the series is complete players have a window to agree to
+	// play again before the match closes
+	RematchWindowMs int64           `json:"rematch_window_ms"`
+	RematchOffers   map[string]bool `json:"rematch_offers"` // User IDs that want a rematch
+	RematchDeadline time.Time       `json:"rematch_deadline"`
+	
+	// Shutdown; completed and abandoned matches close instead of idling forever
+	CloseAfterMs   int64     `json:"close_after_ms"`   // How long a completed match stays open
+	EmptyTimeoutMs int64     `json:"empty_timeout_ms"` // How long a match may run with nobody connected
+	IdleSince      time.Time `json:"idle_since"`       // When the last presence left or the last signal was applied
+	CloseAt        time.Time `json:"close_at"`
+	CloseReason    string    `json:"close_reason"`
+	JoinDeadline   time.Time `json:"join_deadline"` // When a reserved match closes if its seats are not filled, zero if not reserved
+	
+	// Protocol version and wire encoding negotiated with each user at join time
+	Protocols map[string]int    `json:"protocols"`
+	Encodings map[string]string `json:"encodings"`
+	
+	// Connected presences by session ID, used to address broadcasts per
+	// encoding; a user who reconnects may briefly hold two sessions
+	presences map[string]runtime.Presence
+}
+
+// matchLabel is the JSON label used to discover and filter matches
+type matchLabel struct {
+	Open      bool   `json:"open"`
+	Type      string `json:"type"`
+	BoardSize int    `json:"board_size"`
+	WinLength int    `json:"win_length"`
+	Spectators int   `json:"spectators"`
+	BestOf    int    `json:"best_of"`
+	Ranked    bool   `json:"ranked"`
+}
+
+// newMatchLabel builds the label for the current state
+func newMatchLabel(s *TicTacToeState) string {
+	label := matchLabel{
+		Open:      s.MatchState == MatchStateInit && len(s.Reserved) == 0,
+		Type:      "tic_tac_toe",
+		BoardSize: s.Board.Size,
+		WinLength: s.Board.WinLength,
+		Spectators: s.spectatorCount(),
+		BestOf:    s.BestOf,
+		Ranked:    s.Ranked,
+	}
+	labelJSON, _ := json.Marshal(label)
+	return string(labelJSON)
+}
+
+// intParam reads an integer match parameter, accepting the numeric types that
+// MatchCreate callers and JSON decoding produce
+func intParam(params map[string]interface{}, key string, fallback int) (int, bool) {
+	switch v := params[key].(type) {
+	case nil:
+		return fallback, true
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// stringsParam reads a list of strings match parameter, accepting the slice
+// types that MatchCreate callers and JSON decoding produce
+func stringsParam(params map[string]interface{}, key string) ([]string, bool) {
+	switch v := params[key].(type) {
+	case nil:
+		return nil, true
+	case []string:
+		return v, true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			value, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, value)
+		}
+		return values, true
+	}
+	return nil, false
 }
 
 // createTicTacToeMatch creates a new Tic-Tac-Toe match
@@ -53,6 +178,7 @@ type TicTacToeMatch struct {
 	matchID   string
 	state     *TicTacToeState
 	rng       *rand.Rand
+	strategy  bot.Strategy // Chooses the bot's moves in bot matches
 	tickRate  int
 	labelUpdateRateSec int
 }
@@ -66,23 +192,92 @@ func (m *TicTacToeMatch) MatchInit(ctx context.Context, logger runtime.Logger, d
 	m.labelUpdateRateSec = 5
 	m.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 	
+	// Read the board variant, defaulting to classic 3x3
+	boardSize, ok := intParam(params, "board_size", game.DefaultSize)
+	if !ok {
+		logger.Error("Invalid board_size param: %v", params["board_size"])
+		return nil, 0, ""
+	}
+	winLength, ok := intParam(params, "win_length", game.DefaultWinLengthFor(boardSize))
+	if !ok {
+		logger.Error("Invalid win_length param: %v", params["win_length"])
+		return nil, 0, ""
+	}
+	board, err := game.NewBoard(boardSize, winLength)
+	if err != nil {
+		logger.Error("Invalid board variant %dx%d/%d: %v", boardSize, boardSize, winLength, err)
+		return nil, 0, ""
+	}
+	
+	// Read the time control; 0 disables a clock
+	moveTimeSec, okMove := intParam(params, "move_time_sec", DefaultMoveTimeSec)
+	gameTimeSec, okGame := intParam(params, "game_time_sec", 0)
+	incrementSec, okIncrement := intParam(params, "increment_sec", 0)
+	if !okMove || !okGame || !okIncrement || moveTimeSec < 0 || gameTimeSec < 0 || incrementSec < 0 {
+		logger.Error("Invalid time control params: move=%v game=%v increment=%v", params["move_time_sec"], params["game_time_sec"], params["increment_sec"])
+		return nil, 0, ""
+	}
+	
+	// Read the series length; even lengths could end tied, so only odd ones
+	// are accepted
+	bestOf, ok := intParam(params, "best_of", 1)
+	if !ok || bestOf < 1 || bestOf > MaxBestOf || bestOf%2 == 0 {
+		logger.Error("Invalid best_of param: %v", params["best_of"])
+		return nil, 0, ""
+	}
+	
+	// Read the reconnect window; 0 forfeits immediately on disconnect
+	reconnectSec, ok := intParam(params, "reconnect_window_sec", DefaultReconnectWindowSec)
+	if !ok || reconnectSec < 0 {
+		logger.Error("Invalid reconnect_window_sec param: %v", params["reconnect_window_sec"])
+		return nil, 0, ""
+	}
+	
+	// Read the rematch window; 0 closes the match without offering one
+	rematchSec, ok := intParam(params, "rematch_window_sec", DefaultRematchWindowSec)
+	if !ok || rematchSec < 0 {
+		logger.Error("Invalid rematch_window_sec param: %v", params["rematch_window_sec"])
+		return nil, 0, ""
+	}
+	
+	// Read when to close completed and empty matches
+	closeAfterSec, okClose := intParam(params, "close_after_sec", DefaultCloseAfterSec)
+	emptyTimeoutSec, okEmpty := intParam(params, "empty_timeout_sec", DefaultEmptyTimeoutSec)
+	if !okClose || !okEmpty || closeAfterSec < 0 || emptyTimeoutSec < 0 {
+		logger.Error("Invalid close params: close_after=%v empty_timeout=%v", params["close_after_sec"], params["empty_timeout_sec"])
+		return nil, 0, ""
+	}
+	joinTimeoutSec, ok := intParam(params, "join_timeout_sec", DefaultJoinTimeoutSec)
+	if !ok || joinTimeoutSec < 1 {
+		logger.Error("Invalid join_timeout_sec param: %v", params["join_timeout_sec"])
+		return nil, 0, ""
+	}
+	
 	// Initialize game state
 	state := &TicTacToeState{
-		Board:       make([][]int, BoardSize),
-		CurrentTurn: MarkX, // X goes first
-		Winner:      0,
-		Players:     make(map[string]int),
+		Board:       board,
+		CurrentTurn: game.X, // X goes first
+		Winner:      game.InProgress,
+		Players:     make(map[string]game.Mark),
 		Presences:   make(map[string]bool),
+		Spectators:  make(map[string]bool),
+		BestOf:      bestOf,
+		SeriesScore: make(map[string]int),
 		MatchState:  MatchStateInit,
 		LastMoveTime: time.Now(),
-	}
-	
-	// Initialize empty board
-	for i := 0; i < BoardSize; i++ {
-		state.Board[i] = make([]int, BoardSize)
-		for j := 0; j < BoardSize; j++ {
-			state.Board[i][j] = MarkEmpty
-		}
+		MoveTimeMs:  int64(moveTimeSec) * 1000,
+		GameTimeMs:  int64(gameTimeSec) * 1000,
+		IncrementMs: int64(incrementSec) * 1000,
+		ReconnectWindowMs: int64(reconnectSec) * 1000,
+		DisconnectedAt: make(map[string]time.Time),
+		RematchWindowMs: int64(rematchSec) * 1000,
+		RematchOffers: make(map[string]bool),
+		CloseAfterMs: int64(closeAfterSec) * 1000,
+		EmptyTimeoutMs: int64(emptyTimeoutSec) * 1000,
+		IdleSince:   time.Now(),
+		Protocols:   make(map[string]int),
+		Encodings:   make(map[string]string),
+		presences:   make(map[string]runtime.Presence),
 	}
 	
 	// Check if this is a bot match
@@ -97,295 +292,409 @@ func (m *TicTacToeMatch) MatchInit(ctx context.Context, logger runtime.Logger, d
 		} else {
 			state.BotDifficulty = "medium" // Default difficulty
 		}
+		
+		// Get the bot strategy, defaulting to the one named after the difficulty
+		state.BotStrategy = state.BotDifficulty
+		if name, ok := params["bot_strategy"].(string); ok && name != "" {
+			state.BotStrategy = name
+		}
+		if _, ok := params["bot_level"]; ok {
+			level, ok := intParam(params, "bot_level", 0)
+			if !ok || level < bot.MinLevel || level > bot.MaxLevel {
+				logger.Error("Invalid bot_level param: %v", params["bot_level"])
+				return nil, 0, ""
+			}
+			state.BotStrategy = bot.LevelName(level)
+			state.BotDifficulty = state.BotStrategy
+			state.BotLevel = level
+		}
+		
+		// Adaptive bots start from a level and retune once the player is known
+		if state.BotDifficulty == AdaptiveDifficulty {
+			state.BotSkill = adaptiveNewPlayerLevel
+			state.BotLevel = adaptiveNewPlayerLevel
+			state.BotStrategy = bot.LevelName(state.BotLevel)
+		}
+		strategy, err := bot.New(state.BotStrategy, m.rng)
+		if err != nil {
+			logger.Error("Invalid bot strategy %q: %v", state.BotStrategy, err)
+			return nil, 0, ""
+		}
+		m.strategy = strategy
+		
+		// Search-based bots may be tuned by their iteration budget
+		if mcts, ok := strategy.(*bot.MCTS); ok {
+			iterations, ok := intParam(params, "bot_iterations", mcts.Iterations)
+			if !ok || iterations < 1 {
+				logger.Error("Invalid bot_iterations param: %v", params["bot_iterations"])
+				return nil, 0, ""
+			}
+			mcts.Iterations = iterations
+		}
+		
+		// Get bot thinking time, defaulting to the difficulty's range
+		delay, ok := botDelays[state.BotDifficulty]
+		if !ok {
+			delay = botDelays["medium"]
+		}
+		minMs, okMin := intParam(params, "bot_delay_min_ms", delay.MinMs)
+		maxMs, okMax := intParam(params, "bot_delay_max_ms", max(delay.MaxMs, minMs))
+		if !okMin || !okMax || minMs < 0 || maxMs < minMs {
+			logger.Error("Invalid bot delay params: min=%v max=%v", params["bot_delay_min_ms"], params["bot_delay_max_ms"])
+			return nil, 0, ""
+		}
+		state.BotDelay = botDelay{MinMs: minMs, MaxMs: maxMs}
+		
+		// The human moves first unless they asked to play O or left it to chance
+		playerMark, _ := params["player_mark"].(string)
+		switch playerMark {
+		case "", PlayerMarkX:
+			state.BotMark = game.O
+		case PlayerMarkO:
+			state.BotMark = game.X
+		case PlayerMarkRandom:
+			state.BotMark = game.Mark(1 + m.rng.Intn(2))
+		default:
+			logger.Error("Invalid player_mark param: %v", params["player_mark"])
+			return nil, 0, ""
+		}
+	}
+	
+	// Seats may be held for the players a match was created for
+	reserved, ok := stringsParam(params, "reserved")
+	if !ok {
+		logger.Error("Invalid reserved param: %v", params["reserved"])
+		return nil, 0, ""
+	}
+	state.Reserved = reserved
+	if len(reserved) > 0 {
+		state.JoinDeadline = time.Now().Add(time.Duration(joinTimeoutSec) * time.Second)
 	}
+	state.Ranked, _ = params["ranked"].(bool)
 	
 	m.state = state
 	
 	// Set match label for discoverability
-	label := map[string]interface{}{
-		"open": true,
-		"type": "tic_tac_toe",
-	}
-    labelJSON, _ := json.Marshal(label)
-    return state, m.tickRate, string(labelJSON)
+    return state, m.tickRate, newMatchLabel(state)
 }
 
 // MatchJoinAttempt is called when a player attempts to join the match
 func (m *TicTacToeMatch) MatchJoinAttempt(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presence runtime.Presence, metadata map[string]string) (interface{}, bool, string) {
 	s := state.(*TicTacToeState)
 	
-	// Check if the match is already full
-	if len(s.Players) >= 2 && !s.BotMatch {
-        return s, false, "Match is full"
+	// Agree on a protocol version before anything else
+	version, ok := negotiateProtocol(metadata)
+	if !ok {
+        return s, false, "Unsupported protocol version"
+	}
+	encoding, ok := negotiateEncoding(metadata)
+	if !ok {
+        return s, false, "Unsupported encoding"
 	}
 	
-	// Check if the player is already in the match
+	// Players who are already in the match may always come back, even when it
+	// is full, so they can resume within the reconnect window
 	if _, ok := s.Players[presence.GetUserId()]; ok {
+		s.Protocols[presence.GetUserId()] = version
+		s.Encodings[presence.GetUserId()] = encoding
         return s, true, "Rejoining match"
 	}
 	
+	// Spectators are admitted regardless of seats; they are tracked from the
+	// attempt so MatchJoin does not seat them
+	if metadata["spectator"] == "true" {
+		if _, ok := s.Spectators[presence.GetUserId()]; !ok && len(s.Spectators) >= MaxSpectators {
+            return s, false, "Too many spectators"
+		}
+		s.Spectators[presence.GetUserId()] = false
+		s.Protocols[presence.GetUserId()] = version
+		s.Encodings[presence.GetUserId()] = encoding
+        return s, true, "Spectating match"
+	}
+	
+	// Check if the match is already full
+	if len(s.Players) >= 2 && !s.BotMatch {
+        return s, false, "Match is full"
+	}
+	
 	// For bot matches, only allow one human player
 	if s.BotMatch && len(s.Players) >= 1 {
-		// Check if this is the same player reconnecting
-		for playerID := range s.Players {
-			if playerID == presence.GetUserId() {
-                return s, true, "Rejoining bot match"
-			}
-		}
         return s, false, "Bot match already has a player"
 	}
 	
+	// Matches created for particular players keep the seats for them
+	if !s.reservedFor(presence.GetUserId()) {
+        return s, false, "Match is reserved for other players"
+	}
+	
+	s.Protocols[presence.GetUserId()] = version
+	s.Encodings[presence.GetUserId()] = encoding
     return s, true, "Join successful"
 }
 
 // MatchJoin is called when a player successfully joins the match
 func (m *TicTacToeMatch) MatchJoin(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
 	s := state.(*TicTacToeState)
+	s.Tick = tick
 	
+	spectatorsChanged := false
 	for _, presence := range presences {
 		userID := presence.GetUserId()
+		s.presences[presence.GetSessionId()] = presence
 		
-		// Assign player mark if not already assigned
-		if _, ok := s.Players[userID]; !ok {
-			// First player is X, second is O
-			if len(s.Players) == 0 {
-				s.Players[userID] = MarkX
-			} else {
-				s.Players[userID] = MarkO
-			}
+		// Spectators only receive messages
+		if _, ok := s.Spectators[userID]; ok {
+			s.Spectators[userID] = true
+			spectatorsChanged = true
+			continue
+		}
+		
+		// A player returning within the reconnect window resumes the game
+		if _, ok := s.DisconnectedAt[userID]; ok {
+			delete(s.DisconnectedAt, userID)
+			
+			m.broadcast(dispatcher, s, OpCodeOpponentReconnected, reconnectedMessage{Message: "Opponent reconnected", UserID: userID}, nil)
 		}
 		
+		m.seatPlayer(s, userID)
+		
 		// Mark player as present
 		s.Presences[userID] = true
 	}
 	
+	m.startIfReady(ctx, dispatcher, s)
+	if spectatorsChanged {
+		dispatcher.MatchLabelUpdate(newMatchLabel(s))
+	}
+	
+	// Send every joining presence the full state so new and returning players
+	// can draw the game
+	m.sendSnapshot(dispatcher, s, presences)
+	
+	return s
+}
+
+// reservedFor reports whether the seats are open to userID; matches created
+// for particular players keep them for those players
+func (s *TicTacToeState) reservedFor(userID string) bool {
+	return len(s.Reserved) == 0 || slices.Contains(s.Reserved, userID)
+}
+
+// seatPlayer assigns a mark to userID if they do not have one yet
+func (m *TicTacToeMatch) seatPlayer(s *TicTacToeState, userID string) {
+	if _, ok := s.Players[userID]; ok {
+		return
+	}
+	
+	// The human in a bot match takes the side the bot does not play
+	if s.BotMatch {
+		s.Players[userID] = s.BotMark.Opponent()
+		return
+	}
+	
+	// First player is X, second is O
+	if len(s.Players) == 0 {
+		s.Players[userID] = game.X
+	} else {
+		s.Players[userID] = game.O
+	}
+}
+
+// startIfReady adds the bot when needed and starts the game once both seats
+// are taken
+func (m *TicTacToeMatch) startIfReady(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState) {
 	// If this is a bot match and we have one player, add a bot player
 	if s.BotMatch && len(s.Players) == 1 {
-		// Add bot as player 2 (O)
-		s.Players["bot"] = MarkO
+		// Add the bot on the side the match was created with
+		s.Players["bot"] = s.BotMark
 		s.Presences["bot"] = true
+		
+		if s.BotDifficulty == AdaptiveDifficulty {
+			for userID := range s.Players {
+				if userID != "bot" {
+					m.startAdaptiveBot(ctx, s, userID)
+				}
+			}
+		}
 	}
 	
 	// Check if we have enough players to start
-	if len(s.Players) == 2 {
+	if len(s.Players) == 2 && s.MatchState == MatchStateInit {
 		s.MatchState = MatchStateReady
 		
 		// Notify players that the game is ready
-		dispatcher.BroadcastMessage(1, []byte(`{"message":"Game is ready to start"}`), nil, nil, true)
+		m.broadcast(dispatcher, s, OpCodeGameReady, statusMessage{Message: "Game is ready to start"}, nil)
 		
 		// Start the game
 		s.MatchState = MatchStateInProgress
-		dispatcher.BroadcastMessage(2, []byte(`{"message":"Game started"}`), nil, nil, true)
+		s.Round = 1
+		s.startClocks(time.Now())
+		m.broadcast(dispatcher, s, OpCodeGameStarted, statusMessage{Message: "Game started"}, nil)
 		
-		// If bot goes first, make a move
-		if s.BotMatch && s.CurrentTurn == s.Players["bot"] {
-			s = m.makeBotMove(s, dispatcher)
-		}
+		// If bot goes first, schedule its move
+		m.scheduleBotMove(s)
 	}
-	
-	return s
 }
 
 // MatchLeave is called when a player leaves the match
 func (m *TicTacToeMatch) MatchLeave(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, presences []runtime.Presence) interface{} {
 	s := state.(*TicTacToeState)
 	
+	spectatorsChanged := false
 	for _, presence := range presences {
 		userID := presence.GetUserId()
+		delete(s.presences, presence.GetSessionId())
+		
+		// A reconnect can add the user's new session before the old session's
+		// leave arrives; the user has not left while either is connected
+		if s.connected(userID) {
+			continue
+		}
+		
+		// Spectators leave without affecting the game
+		if _, ok := s.Spectators[userID]; ok {
+			delete(s.Spectators, userID)
+			spectatorsChanged = true
+			continue
+		}
 		
 		// Mark player as not present
 		s.Presences[userID] = false
+		if len(s.presences) == 0 {
+			s.IdleSince = time.Now()
+		}
 		
-		// If the game is in progress, the leaving player forfeits
-		if s.MatchState == MatchStateInProgress && !s.BotMatch {
-			// Find the other player
-			var otherPlayerID string
-			for playerID := range s.Players {
-				if playerID != userID {
-					otherPlayerID = playerID
-					break
-				}
-			}
-			
-			// Set the other player as winner
-			if otherPlayerID != "" {
-				s.Winner = s.Players[otherPlayerID]
-				s.MatchState = MatchStateComplete
-				
-				// Notify players of forfeit
-				message := map[string]interface{}{
-					"message": "Player forfeited",
-					"winner":  otherPlayerID,
+		// If the series is in progress, the leaving player forfeits unless they
+		// return within the reconnect window; this includes a human leaving the
+		// bot
+		if s.seriesActive() {
+			if mark, ok := s.Players[userID]; ok {
+				if s.ReconnectWindowMs > 0 {
+					s.DisconnectedAt[userID] = time.Now()
+					m.broadcastDisconnected(dispatcher, s, userID, s.ReconnectWindowMs)
+				} else {
+					m.finishGame(ctx, dispatcher, s, game.WinFor(mark.Opponent()), "forfeit", "Player forfeited")
 				}
-				messageJSON, _ := json.Marshal(message)
-				dispatcher.BroadcastMessage(3, messageJSON, nil, nil, true)
-				
-				// Update player stats
-				m.updatePlayerStats(ctx, otherPlayerID, true, false)
-				m.updatePlayerStats(ctx, userID, false, false)
-				
-				// Record match result
-				m.recordMatchResult(ctx, s)
 			}
 		}
 	}
 	
+	if spectatorsChanged {
+		dispatcher.MatchLabelUpdate(newMatchLabel(s))
+	}
+	
 	return s
 }
 
 // MatchLoop is called on each match tick
 func (m *TicTacToeMatch) MatchLoop(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, messages []runtime.MatchData) interface{} {
 	s := state.(*TicTacToeState)
+	s.Tick = tick
 	
 	// Process player messages
 	for _, message := range messages {
-		if message.GetOpCode() == 1 { // Move operation
+		switch message.GetOpCode() {
+		case OpCodeResyncRequest:
+			m.sendSnapshot(dispatcher, s, []runtime.Presence{message})
+			
+		case OpCodeMove:
 			// Only process moves if the game is in progress
 			if s.MatchState != MatchStateInProgress {
+				m.reject(dispatcher, s, message, OpCodeMove, errGameNotInProgress)
 				continue
 			}
 			
 			// Parse move data
-			var move struct {
-				Row int `json:"row"`
-				Col int `json:"col"`
-			}
-			
-			if err := json.Unmarshal(message.GetData(), &move); err != nil {
-				logger.Error("Error parsing move data: %v", err)
+			move, err := decodeMove(s, message)
+			if err != nil {
+				logger.Warn("Error parsing move data: %v", err)
+				m.reject(dispatcher, s, message, OpCodeMove, errInvalidPayload)
 				continue
 			}
 			
-			// Validate move
-			if move.Row < 0 || move.Row >= BoardSize || move.Col < 0 || move.Col >= BoardSize {
-				logger.Error("Invalid move: out of bounds")
+			if err := m.applyMove(ctx, dispatcher, s, message.GetUserId(), game.Move{Row: move.Row, Col: move.Col}); err != nil {
+				logger.Debug("Rejected move from %s: %v", message.GetUserId(), err)
+				m.reject(dispatcher, s, message, OpCodeMove, err)
 				continue
 			}
 			
-			if s.Board[move.Row][move.Col] != MarkEmpty {
-				logger.Error("Invalid move: cell already occupied")
-				continue
-			}
+			// If it's a bot match and it's the bot's turn, schedule a bot move
+			m.scheduleBotMove(s)
 			
-			// Check if it's the player's turn
-			playerMark := s.Players[message.GetUserId()]
-			if playerMark != s.CurrentTurn {
-				logger.Error("Invalid move: not player's turn")
-				continue
+		case OpCodeRematchOffer, OpCodeRematchAccept:
+			accept := message.GetOpCode() == OpCodeRematchAccept
+			if err := m.offerRematch(ctx, dispatcher, s, message.GetUserId(), accept); err != nil {
+				m.reject(dispatcher, s, message, message.GetOpCode(), err)
 			}
 			
-			// Make the move
-			s.Board[move.Row][move.Col] = playerMark
-			s.LastMoveTime = time.Now()
-			
-			// Check for win or draw
-			if m.checkWin(s.Board, move.Row, move.Col) {
-				s.Winner = playerMark
-				s.MatchState = MatchStateComplete
-				
-				// Notify players of win
-				winnerID := message.GetUserId()
-				var loserID string
-				for playerID, mark := range s.Players {
-					if mark != playerMark {
-						loserID = playerID
-						break
-					}
-				}
-				
-				winMessage := map[string]interface{}{
-					"message": "Player won",
-					"winner":  winnerID,
-				}
-				winMessageJSON, _ := json.Marshal(winMessage)
-				dispatcher.BroadcastMessage(3, winMessageJSON, nil, nil, true)
-				
-				// Update player stats
-				m.updatePlayerStats(ctx, winnerID, true, false)
-				if loserID != "bot" {
-					m.updatePlayerStats(ctx, loserID, false, false)
-				}
-				
-				// Record match result
-				m.recordMatchResult(ctx, s)
-			} else if m.checkDraw(s.Board) {
-				s.Winner = 3 // Draw
-				s.MatchState = MatchStateComplete
-				
-				// Notify players of draw
-				drawMessage := map[string]interface{}{
-					"message": "Game ended in a draw",
-				}
-				drawMessageJSON, _ := json.Marshal(drawMessage)
-				dispatcher.BroadcastMessage(3, drawMessageJSON, nil, nil, true)
-				
-				// Update player stats for both players
-				for playerID := range s.Players {
-					if playerID != "bot" {
-						m.updatePlayerStats(ctx, playerID, false, true)
-					}
-				}
-				
-				// Record match result
-				m.recordMatchResult(ctx, s)
-			} else {
-				// Switch turns
-				if s.CurrentTurn == MarkX {
-					s.CurrentTurn = MarkO
-				} else {
-					s.CurrentTurn = MarkX
-				}
-				
-				// Notify players of the move
-				moveMessage := map[string]interface{}{
-					"row":          move.Row,
-					"col":          move.Col,
-					"mark":         playerMark,
-					"current_turn": s.CurrentTurn,
-				}
-				moveMessageJSON, _ := json.Marshal(moveMessage)
-				dispatcher.BroadcastMessage(4, moveMessageJSON, nil, nil, true)
-				
-				// If it's a bot match and it's the bot's turn, make a bot move
-				if s.BotMatch && s.CurrentTurn == s.Players["bot"] {
-					s = m.makeBotMove(s, dispatcher)
-				}
-			}
+		default:
+			m.reject(dispatcher, s, message, message.GetOpCode(), errUnknownOpCode)
 		}
 	}
 	
-	// Check for inactive game
-	if s.MatchState == MatchStateInProgress && time.Since(s.LastMoveTime) > 5*time.Minute {
-		// End the game as a draw due to inactivity
-		s.Winner = 3 // Draw
-		s.MatchState = MatchStateComplete
-		
-		// Notify players of timeout
-		timeoutMessage := map[string]interface{}{
-			"message": "Game ended due to inactivity",
+	// Play the bot's move once its thinking time is over
+	m.playDueBotMove(ctx, dispatcher, s)
+	
+	now := time.Now()
+	
+	// Forfeit the player whose reconnect window expired first, otherwise keep
+	// counting down for their opponent. When every player of a PvP match has
+	// dropped nobody is to blame, so the series is abandoned instead.
+	if userID, expired := s.reconnectExpired(now); expired && s.seriesActive() {
+		if !s.BotMatch && len(s.DisconnectedAt) == len(s.Players) {
+			m.finishGame(ctx, dispatcher, s, game.Draw, "abandoned", "Both players disconnected")
+		} else {
+			delete(s.DisconnectedAt, userID)
+			m.finishGame(ctx, dispatcher, s, game.WinFor(s.Players[userID].Opponent()), "forfeit", "Player forfeited")
 		}
-		timeoutMessageJSON, _ := json.Marshal(timeoutMessage)
-		dispatcher.BroadcastMessage(3, timeoutMessageJSON, nil, nil, true)
-		
-		// Update player stats for both players
-		for playerID := range s.Players {
-			if playerID != "bot" {
-				m.updatePlayerStats(ctx, playerID, false, true)
-			}
+	} else if s.seriesActive() {
+		for userID, leftAt := range s.DisconnectedAt {
+			m.broadcastDisconnected(dispatcher, s, userID, s.ReconnectWindowMs-now.Sub(leftAt).Milliseconds())
 		}
-		
-		// Record match result
-		m.recordMatchResult(ctx, s)
+	}
+	
+	if s.MatchState == MatchStateInProgress && s.clocked() {
+		// The player to move loses once either of their clocks runs out
+		if userID, flagged := s.flagged(now); flagged {
+			m.finishGame(ctx, dispatcher, s, game.WinFor(s.Players[userID].Opponent()), "timeout", "Player ran out of time")
+		} else {
+			m.broadcast(dispatcher, s, OpCodeClock, s.clockMessage(now), nil)
+		}
+	} else if s.MatchState == MatchStateInProgress && now.Sub(s.LastMoveTime) > 5*time.Minute {
+		// Unclocked games still end as a draw after a long period of inactivity
+		m.finishGame(ctx, dispatcher, s, game.Draw, "inactivity", "Game ended due to inactivity")
+	}
+	
+	// Start the next game of a series once the pause is over
+	if s.MatchState == MatchStateBetweenGames && !now.Before(s.NextGameAt) {
+		m.startNextGame(ctx, dispatcher, s)
+	}
+	
+	// Close completed matches on schedule and abandon empty ones; returning nil
+	// ends the match
+	if reason, closing := s.closeReason(now); closing {
+		if s.seriesActive() && s.BotMatch {
+			// Only the human can abandon a bot match, so the bot takes it
+			m.finishGame(ctx, dispatcher, s, game.WinFor(s.Players["bot"]), "forfeit", "Player abandoned the match")
+		} else if s.seriesActive() {
+			m.finishGame(ctx, dispatcher, s, game.Draw, "abandoned", "Match abandoned")
+		}
+		switch reason {
+		case CloseReasonShutdown:
+			// Already announced by MatchTerminate
+		case CloseReasonNoShow:
+			m.broadcast(dispatcher, s, OpCodeMatchClosed, closedMessage{Message: "Match closed, not every player joined in time", Reason: reason}, nil)
+		case CloseReasonEmpty:
+			m.broadcast(dispatcher, s, OpCodeMatchClosed, closedMessage{Message: "Match closed, nobody is connected", Reason: reason}, nil)
+		default:
+			m.broadcast(dispatcher, s, OpCodeMatchClosed, closedMessage{Message: "Match closed", Reason: reason}, nil)
+		}
+		return nil
 	}
 	
 	// Update match label periodically
 	if tick%int64(m.tickRate*m.labelUpdateRateSec) == 0 {
-		label := map[string]interface{}{
-			"open": s.MatchState == MatchStateInit,
-			"type": "tic_tac_toe",
-		}
-		labelJSON, _ := json.Marshal(label)
-		dispatcher.MatchLabelUpdate(string(labelJSON))
+		dispatcher.MatchLabelUpdate(newMatchLabel(s))
 	}
 	
 	return s
@@ -395,391 +704,394 @@ func (m *TicTacToeMatch) MatchLoop(ctx context.Context, logger runtime.Logger, d
 func (m *TicTacToeMatch) MatchTerminate(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, graceSeconds int) interface{} {
 	s := state.(*TicTacToeState)
 	
-	// If the game is still in progress, end it as a draw
-	if s.MatchState == MatchStateInProgress {
-		s.Winner = 3 // Draw
-		s.MatchState = MatchStateComplete
-		
-		// Update player stats for both players
-		for playerID := range s.Players {
-			if playerID != "bot" {
-				m.updatePlayerStats(ctx, playerID, false, true)
-			}
-		}
-		
-		// Record match result
-		m.recordMatchResult(ctx, s)
+	// If the series is still in progress, end it as a draw
+	if s.seriesActive() {
+		m.finishGame(ctx, dispatcher, s, game.Draw, "terminated", "Match terminated by server")
+	}
+	
+	// Warn everyone, then close on the next tick so the final messages are
+	// delivered within the grace period
+	closing := closedMessage{
+		Message:          "Server is shutting down",
+		Reason:           CloseReasonShutdown,
+		SecondsRemaining: int64(graceSeconds),
 	}
+	m.broadcast(dispatcher, s, OpCodeMatchClosed, closing, nil)
+	if graceSeconds <= 0 {
+		return nil
+	}
+	s.RematchDeadline = time.Time{}
+	s.CloseAt = time.Now()
+	s.CloseReason = CloseReasonShutdown
 	
 	return s
 }
 
-// MatchSignal handles match signals; no-ops for this match type
+// MatchSignal applies signed commands sent by RPCs through nk.MatchSignal and
+// returns the result to the caller
 func (m *TicTacToeMatch) MatchSignal(ctx context.Context, logger runtime.Logger, db *sql.DB, nk runtime.NakamaModule, dispatcher runtime.MatchDispatcher, tick int64, state interface{}, data string) (interface{}, string) {
-    return state, ""
-}
-
-// makeBotMove makes a move for the bot based on difficulty
-func (m *TicTacToeMatch) makeBotMove(s *TicTacToeState, dispatcher runtime.MatchDispatcher) *TicTacToeState {
-	// Wait a bit to simulate thinking
-	time.Sleep(1 * time.Second)
-	
-	var row, col int
-	
-	switch s.BotDifficulty {
-	case "easy":
-		// Easy bot makes random moves
-		row, col = m.makeRandomMove(s.Board)
-	case "hard":
-		// Hard bot uses minimax algorithm
-		row, col = m.makeMinimaxMove(s.Board, s.Players["bot"])
-	default: // medium
-		// Medium bot has 50% chance to make optimal move, 50% chance to make random move
-		if m.rng.Intn(2) == 0 {
-			row, col = m.makeMinimaxMove(s.Board, s.Players["bot"])
-		} else {
-			row, col = m.makeRandomMove(s.Board)
-		}
-	}
+	s := state.(*TicTacToeState)
+	s.Tick = tick
 	
-	// Make the move
-	s.Board[row][col] = s.Players["bot"]
-	s.LastMoveTime = time.Now()
+	cmd, err := verifySignal(data, time.Now())
+	if err != nil {
+		logger.Warn("Rejected match signal: %v", err)
+		return s, newSignalResult(s, "", err)
+	}
 	
-	// Check for win or draw
-	if m.checkWin(s.Board, row, col) {
-		s.Winner = s.Players["bot"]
-		s.MatchState = MatchStateComplete
-		
-		// Notify players of bot win
-		winMessage := map[string]interface{}{
-			"message": "Bot won",
-			"winner":  "bot",
-		}
-		winMessageJSON, _ := json.Marshal(winMessage)
-		dispatcher.BroadcastMessage(3, winMessageJSON, nil, nil, true)
-		
-		// Update player stats for human player
-		for playerID := range s.Players {
-			if playerID != "bot" {
-				m.updatePlayerStats(context.Background(), playerID, false, false)
+	switch cmd.Command {
+	case SignalJoin:
+		// Same seating rules as MatchJoinAttempt, minus the socket presence
+		if _, ok := s.Players[cmd.UserID]; !ok {
+			if len(s.Players) >= 2 || (s.BotMatch && len(s.Players) >= 1) {
+				err = errMatchFull
 				break
 			}
-		}
-		
-		// Record match result
-		m.recordMatchResult(context.Background(), s)
-	} else if m.checkDraw(s.Board) {
-		s.Winner = 3 // Draw
-		s.MatchState = MatchStateComplete
-		
-		// Notify players of draw
-		drawMessage := map[string]interface{}{
-			"message": "Game ended in a draw",
-		}
-		drawMessageJSON, _ := json.Marshal(drawMessage)
-		dispatcher.BroadcastMessage(3, drawMessageJSON, nil, nil, true)
-		
-		// Update player stats for human player
-		for playerID := range s.Players {
-			if playerID != "bot" {
-				m.updatePlayerStats(context.Background(), playerID, false, true)
+			if !s.reservedFor(cmd.UserID) {
+				err = errMatchReserved
 				break
 			}
+			m.seatPlayer(s, cmd.UserID)
+			m.startIfReady(ctx, dispatcher, s)
 		}
 		
-		// Record match result
-		m.recordMatchResult(context.Background(), s)
-	} else {
-		// Switch turns
-		s.CurrentTurn = MarkX
+	case SignalMove:
+		// Same validation as OpCodeMove in MatchLoop
+		if s.MatchState != MatchStateInProgress {
+			err = errGameNotInProgress
+			break
+		}
+		var move game.Move
+		if move, err = cmd.move(s.Board.Size); err != nil {
+			break
+		}
+		if err = m.applyMove(ctx, dispatcher, s, cmd.UserID, move); err != nil {
+			break
+		}
+		m.scheduleBotMove(s)
 		
-		// Notify players of the bot move
-		moveMessage := map[string]interface{}{
-			"row":          row,
-			"col":          col,
-			"mark":         s.Players["bot"],
-			"current_turn": s.CurrentTurn,
+	case SignalAbort:
+		if !s.seriesActive() {
+
+			err = errGameNotInProgress
+			break
 		}
-		moveMessageJSON, _ := json.Marshal(moveMessage)
-		dispatcher.BroadcastMessage(4, moveMessageJSON, nil, nil, true)
+		m.finishGame(ctx, dispatcher, s, game.Draw, "aborted", "Match aborted by server")
+		
+	default:
+		err = errUnknownCommand
 	}
 	
-	return s
+	if err != nil {
+		logger.Debug("Rejected %s signal from %s: %v", cmd.Command, cmd.UserID, err)
+	} else if len(s.presences) == 0 {
+		// Matches played purely over RPC have no presences; keep them alive
+		// while commands arrive
+		s.IdleSince = time.Now()
+	}
+	return s, newSignalResult(s, cmd.UserID, err)
 }
 
-// makeRandomMove returns a random valid move
-func (m *TicTacToeMatch) makeRandomMove(board [][]int) (int, int) {
-	// Find all empty cells
-	var emptyCells [][2]int
-	for i := 0; i < BoardSize; i++ {
-		for j := 0; j < BoardSize; j++ {
-			if board[i][j] == MarkEmpty {
-				emptyCells = append(emptyCells, [2]int{i, j})
-			}
-		}
-	}
-	
-	// Pick a random empty cell
-	if len(emptyCells) > 0 {
-		randomIndex := m.rng.Intn(len(emptyCells))
-		return emptyCells[randomIndex][0], emptyCells[randomIndex][1]
+// sendSnapshot sends the full public state to the given presences
+func (m *TicTacToeMatch) sendSnapshot(dispatcher runtime.MatchDispatcher, s *TicTacToeState, presences []runtime.Presence) {
+	now := time.Now()
+	for _, presence := range presences {
+		snap := s.snapshot(now)
+		snap.ProtocolVersion = s.Protocols[presence.GetUserId()]
+		_, snap.Spectator = s.Spectators[presence.GetUserId()]
+		m.broadcast(dispatcher, s, OpCodeStateSnapshot, snap, []runtime.Presence{presence})
 	}
-	
-	// Should never reach here if board validation is correct
-	return 0, 0
 }
 
-// makeMinimaxMove returns the best move using minimax algorithm
-func (m *TicTacToeMatch) makeMinimaxMove(board [][]int, botMark int) (int, int) {
-	// Define opponent mark
-	opponentMark := MarkX
-	if botMark == MarkX {
-		opponentMark = MarkO
-	}
-	
-	// Find best move
-	var bestScore = -1000
-	var bestRow, bestCol int
-	
-	for i := 0; i < BoardSize; i++ {
-		for j := 0; j < BoardSize; j++ {
-			// Check if cell is empty
-			if board[i][j] == MarkEmpty {
-				// Make the move
-				board[i][j] = botMark
-				
-				// Calculate score using minimax
-				score := m.minimax(board, 0, false, botMark, opponentMark)
-				
-				// Undo the move
-				board[i][j] = MarkEmpty
-				
-				// Update best score
-				if score > bestScore {
-					bestScore = score
-					bestRow = i
-					bestCol = j
-				}
-			}
+// reconnectExpired returns the player whose reconnect window ran out first, if
+// any has
+func (s *TicTacToeState) reconnectExpired(now time.Time) (string, bool) {
+	var first string
+	var firstLeftAt time.Time
+	for userID, leftAt := range s.DisconnectedAt {
+		if now.Sub(leftAt).Milliseconds() < s.ReconnectWindowMs {
+			continue
+		}
+		if first == "" || leftAt.Before(firstLeftAt) || (leftAt.Equal(firstLeftAt) && userID < first) {
+			first, firstLeftAt = userID, leftAt
 		}
 	}
-	
-	return bestRow, bestCol
+	return first, first != ""
 }
 
-// minimax implements the minimax algorithm for optimal move selection
-func (m *TicTacToeMatch) minimax(board [][]int, depth int, isMaximizing bool, botMark int, opponentMark int) int {
-	// Check for terminal states
-	if m.checkWinForMark(board, botMark) {
-		return 10 - depth
+// broadcastDisconnected tells players how long a dropped player has to return
+func (m *TicTacToeMatch) broadcastDisconnected(dispatcher runtime.MatchDispatcher, s *TicTacToeState, userID string, remainingMs int64) {
+	message := disconnectedMessage{
+		Message:          "Opponent disconnected",
+		UserID:           userID,
+		SecondsRemaining: (remainingMs + 999) / 1000,
 	}
-	if m.checkWinForMark(board, opponentMark) {
-		return depth - 10
+	m.broadcast(dispatcher, s, OpCodeOpponentDisconnected, message, nil)
+}
+
+// applyMove validates and plays a move for userID, then either finishes the
+// game or passes the turn and broadcasts the move
+func (m *TicTacToeMatch) applyMove(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState, userID string, move game.Move) error {
+	// Only seated players may move, and only on their turn
+	playerMark, ok := s.Players[userID]
+	if !ok {
+		if _, spectating := s.Spectators[userID]; spectating {
+			return errSpectator
+		}
+		return errNotAPlayer
 	}
-	if m.checkDraw(board) {
-		return 0
+	if playerMark != s.CurrentTurn {
+		return errNotYourTurn
 	}
 	
-	if isMaximizing {
-		// Maximizing player (bot)
-		var bestScore = -1000
-		
-		for i := 0; i < BoardSize; i++ {
-			for j := 0; j < BoardSize; j++ {
-				if board[i][j] == MarkEmpty {
-					board[i][j] = botMark
-					score := m.minimax(board, depth+1, false, botMark, opponentMark)
-					board[i][j] = MarkEmpty
-					bestScore = max(score, bestScore)
-				}
-			}
+	// A move that arrives after the player's time ran out loses on time, even
+	// if MatchLoop has not checked the clocks yet this tick
+	now := time.Now()
+	if flaggedID, flagged := s.flagged(now); flagged {
+		m.finishGame(ctx, dispatcher, s, game.WinFor(s.Players[flaggedID].Opponent()), "timeout", "Player ran out of time")
+		return errGameNotInProgress
+	}
+	
+	// Validate and make the move
+	if err := s.Board.Play(move, playerMark); err != nil {
+		return err
+	}
+	s.LastMoveTime = now
+	s.chargeClock(userID, now)
+	
+	// Check for win or draw
+	outcome := s.Board.OutcomeAfter(move)
+	switch {
+	case outcome == game.WinFor(playerMark):
+		message := "Player won"
+		if userID == "bot" {
+			message = "Bot won"
 		}
+		m.finishGame(ctx, dispatcher, s, outcome, "line", message)
+	case outcome == game.Draw:
+		m.finishGame(ctx, dispatcher, s, outcome, "draw", "Game ended in a draw")
+	default:
+		// Switch turns
+		s.CurrentTurn = playerMark.Opponent()
+		s.TurnStartedAt = now
 		
-		return bestScore
-	} else {
-		// Minimizing player (opponent)
-		var bestScore = 1000
-		
-		for i := 0; i < BoardSize; i++ {
-			for j := 0; j < BoardSize; j++ {
-				if board[i][j] == MarkEmpty {
-					board[i][j] = opponentMark
-					score := m.minimax(board, depth+1, true, botMark, opponentMark)
-					board[i][j] = MarkEmpty
-					bestScore = min(score, bestScore)
-				}
-			}
+		// Notify players of the move
+		moveMessage := moveMadeMessage{
+			Row:         move.Row,
+			Col:         move.Col,
+			Mark:        playerMark,
+			CurrentTurn: s.CurrentTurn,
 		}
-		
-		return bestScore
+		m.broadcast(dispatcher, s, OpCodeMoveMade, moveMessage, nil)
 	}
+	
+	return nil
 }
 
-// checkWin checks if the last move resulted in a win
-func (m *TicTacToeMatch) checkWin(board [][]int, row int, col int) bool {
-	mark := board[row][col]
+// finishGame completes the current game with the given outcome and notifies
+// players. Once the series is decided it records stats and match history;
+// otherwise the next game starts after a short pause.
+func (m *TicTacToeMatch) finishGame(ctx context.Context, dispatcher runtime.MatchDispatcher, s *TicTacToeState, outcome game.Outcome, reason string, message string) {
+	s.Winner = outcome
 	
-	// Check row
-	rowWin := true
-	for i := 0; i < BoardSize; i++ {
-		if board[row][i] != mark {
-			rowWin = false
-			break
-		}
+	winnerID := ""
+	if winnerMark := outcome.Winner(); winnerMark != game.Empty {
+		winnerID = s.playerWithMark(winnerMark)
 	}
-	if rowWin {
-		return true
+	
+	// Keep the detail of every game that was actually played
+	if s.MatchState == MatchStateInProgress {
+		s.Games = append(s.Games, gameRecord{
+			Round:   s.Round,
+			X:       s.playerWithMark(game.X),
+			O:       s.playerWithMark(game.O),
+			Outcome: outcome,
+			Winner:  winnerID,
+			Reason:  reason,
+			Board:   s.Board.Clone(),
+		})
+		if winnerID != "" {
+			s.SeriesScore[winnerID]++
+		}
+		if s.BotMatch && s.BotDifficulty == AdaptiveDifficulty {
+			m.adaptBot(s, winnerID)
+		}
 	}
 	
-	// Check column
-	colWin := true
-	for i := 0; i < BoardSize; i++ {
-		if board[i][col] != mark {
-			colWin = false
-			break
+	// Forfeits and server stops end the whole series; otherwise it runs until
+	// a player clinches it or every game has been played
+	seriesOver := true
+	switch reason {
+	case "forfeit":
+		s.SeriesWinner = winnerID
+	case "aborted", "terminated", "abandoned":
+		s.SeriesWinner = ""
+	default:
+		if seriesOver = s.seriesDecided(); seriesOver {
+			s.SeriesWinner = s.seriesLeader()
 		}
 	}
-	if colWin {
-		return true
+	
+	// Notify players of the result
+	result := gameOverMessage{
+		Message:      message,
+		Reason:       reason,
+		Winner:       winnerID,
+		Outcome:      outcome,
+		Round:        s.Round,
+		BestOf:       s.BestOf,
+		SeriesScore:  s.SeriesScore,
+		SeriesOver:   seriesOver,
+		SeriesWinner: s.SeriesWinner,
 	}
 	
-	// Check diagonals
-	if row == col {
-		// Main diagonal
-		diagWin := true
-		for i := 0; i < BoardSize; i++ {
-			if board[i][i] != mark {
-				diagWin = false
-				break
-			}
-		}
-		if diagWin {
-			return true
-		}
+	if !seriesOver {
+		s.MatchState = MatchStateBetweenGames
+		s.NextGameAt = time.Now().Add(SeriesIntermission)
+		m.broadcast(dispatcher, s, OpCodeGameOver, result, nil)
+		return
 	}
 	
-	if row+col == BoardSize-1 {
-		// Anti-diagonal
-		antiDiagWin := true
-		for i := 0; i < BoardSize; i++ {
-			if board[i][BoardSize-1-i] != mark {
-				antiDiagWin = false
-				break
-			}
-		}
-		if antiDiagWin {
-			return true
+	s.MatchState = MatchStateComplete
+	clear(s.DisconnectedAt)
+	m.broadcast(dispatcher, s, OpCodeGameOver, result, nil)
+	
+	// Let the players play again unless the match was stopped from outside
+	now := time.Now()
+	s.RematchDeadline = time.Time{}
+	if !stoppedFromOutside(reason) {
+		s.openRematchWindow(now)
+		if !s.RematchDeadline.IsZero() {
+			m.broadcast(dispatcher, s, OpCodeRematchOffered, s.rematchMessage(now), nil)
 		}
 	}
+	s.scheduleClose(now, CloseReasonComplete)
 	
-	return false
+	// Record the result and update stats once for the whole series
+	m.recordMatchResult(ctx, s, reason)
 }
 
-// checkWinForMark checks if the given mark has won
-func (m *TicTacToeMatch) checkWinForMark(board [][]int, mark int) bool {
-	// Check rows
-	for i := 0; i < BoardSize; i++ {
-		if board[i][0] == mark && board[i][1] == mark && board[i][2] == mark {
-			return true
+// stoppedFromOutside reports whether a series ending for reason was stopped by
+// the server rather than played out or forfeited
+func stoppedFromOutside(reason string) bool {
+	return reason == "aborted" || reason == "terminated" || reason == "abandoned"
+}
+
+// spectatorCount returns how many spectators are currently connected
+func (s *TicTacToeState) spectatorCount() int {
+	count := 0
+	for _, connected := range s.Spectators {
+		if connected {
+			count++
 		}
 	}
-	
-	// Check columns
-	for i := 0; i < BoardSize; i++ {
-		if board[0][i] == mark && board[1][i] == mark && board[2][i] == mark {
+	return count
+}
+
+// presenceList returns every connected presence
+func (s *TicTacToeState) presenceList() []runtime.Presence {
+	presences := make([]runtime.Presence, 0, len(s.presences))
+	for _, presence := range s.presences {
+		presences = append(presences, presence)
+	}
+	return presences
+}
+
+// connected reports whether userID has any session in the match
+func (s *TicTacToeState) connected(userID string) bool {
+	for _, presence := range s.presences {
+		if presence.GetUserId() == userID {
 			return true
 		}
 	}
-	
-	// Check diagonals
-	if board[0][0] == mark && board[1][1] == mark && board[2][2] == mark {
-		return true
-	}
-	if board[0][2] == mark && board[1][1] == mark && board[2][0] == mark {
-		return true
-	}
-	
 	return false
 }
 
-// checkDraw checks if the game is a draw
-func (m *TicTacToeMatch) checkDraw(board [][]int) bool {
-	// Check if board is full
-	for i := 0; i < BoardSize; i++ {
-		for j := 0; j < BoardSize; j++ {
-			if board[i][j] == MarkEmpty {
-				return false
-			}
+// playerWithMark returns the user ID playing the given mark
+func (s *TicTacToeState) playerWithMark(mark game.Mark) string {
+	for playerID, playerMark := range s.Players {
+		if playerMark == mark {
+			return playerID
 		}
 	}
-	
-	// No empty cells and no winner means it's a draw
-	return true
+	return ""
 }
 
-// updatePlayerStats updates a player's stats after a match
-func (m *TicTacToeMatch) updatePlayerStats(ctx context.Context, userID string, win bool, draw bool) {
-	// Skip for bot players
-	if userID == "bot" {
+// makeBotMove plays the move chosen by the match's bot strategy
+func (m *TicTacToeMatch) makeBotMove(ctx context.Context, s *TicTacToeState, dispatcher runtime.MatchDispatcher) {
+	move, err := m.strategy.ChooseMove(s.Board, s.Players["bot"], BotMoveBudget)
+	if err != nil {
+		m.logger.Error("Bot strategy %s failed to choose a move: %v", s.BotStrategy, err)
 		return
 	}
 	
-    // Prepare score change
-    score := 0
-	if win {
-		score = 10
-	} else if draw {
-		score = 5
-	}
-
-    // Apply update directly to DB
-    var query string
-    var args []interface{}
-    if draw {
-        query = `UPDATE player_stats SET draws = draws + 1, score = score + $2, updated_at = NOW() WHERE user_id = $1`
-        args = []interface{}{userID, score}
-    } else if win {
-        query = `UPDATE player_stats SET wins = wins + 1, score = score + $2, updated_at = NOW() WHERE user_id = $1`
-        args = []interface{}{userID, score}
-    } else {
-        query = `UPDATE player_stats SET losses = losses + 1, updated_at = NOW() WHERE user_id = $1`
-        args = []interface{}{userID}
-    }
-    if _, err := m.db.ExecContext(ctx, query, args...); err != nil {
-        m.logger.Error("Error updating player stats: %v", err)
-    }
+	if err := m.applyMove(ctx, dispatcher, s, "bot", move); err != nil {
+		m.logger.Error("Bot produced invalid move: %v", err)
+	}
 }
 
-// recordMatchResult records the match result in the database
-func (m *TicTacToeMatch) recordMatchResult(ctx context.Context, s *TicTacToeState) {
-	// Get player IDs
-	var player1ID, player2ID, winnerID string
-	
-	for playerID, mark := range s.Players {
-		if mark == MarkX {
-			player1ID = playerID
-		} else if mark == MarkO {
-			player2ID = playerID
-		}
+// updateBotStats updates a player's record against the bot at one difficulty
+// inside tx and audits the change
+func updateBotStats(ctx context.Context, tx *sql.Tx, userID, difficulty, matchID string, win bool, draw bool) error {
+	var wins, losses, draws int
+	switch {
+	case draw:
+		draws = 1
+	case win:
+		wins = 1
+	default:
+		losses = 1
 	}
-	
-	// Set winner ID
-	if s.Winner == MarkX {
-		winnerID = player1ID
-	} else if s.Winner == MarkO {
-		winnerID = player2ID
+	query := `
+		INSERT INTO bot_stats (user_id, difficulty, wins, losses, draws)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, difficulty) DO UPDATE SET
+			wins = bot_stats.wins + EXCLUDED.wins,
+			losses = bot_stats.losses + EXCLUDED.losses,
+			draws = bot_stats.draws + EXCLUDED.draws,
+			updated_at = NOW()
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, difficulty, wins, losses, draws); err != nil {
+		return err
 	}
-	
-	// Skip recording for bot matches
-	if player1ID == "bot" || player2ID == "bot" {
+	return auditStatChange(ctx, tx, userID, StatSourceBotMatch, matchID, map[string]interface{}{
+		"difficulty": difficulty,
+		"wins":       wins,
+		"losses":     losses,
+		"draws":      draws,
+	})
+}
+
+// recordMatchResult records the series result in the database and updates
+// the players' stats with it; the per-game detail is kept in the stored game
+// state. Only ranked series that were played out are rated, and series
+// stopped from outside leave the stats alone. Bot games store the human as
+// player 1 and identify the bot by its strategy and difficulty.
+func (m *TicTacToeMatch) recordMatchResult(ctx context.Context, s *TicTacToeState, reason string) {
+	if s.BotMatch {
+		m.recordBotMatchResult(ctx, s, reason)
 		return
 	}
+
+	// Player 1 is whoever moved first in the opening game
+	var player1ID, player2ID string
+	if len(s.Games) > 0 {
+		player1ID, player2ID = s.Games[0].X, s.Games[0].O
+	} else {
+		player1ID, player2ID = s.playerWithMark(game.X), s.playerWithMark(game.O)
+	}
+	
+	// A drawn series has no winner
+	var winnerID interface{}
+	if s.SeriesWinner != "" {
+		winnerID = s.SeriesWinner
+	}
 	
 	// Insert match record
 	query := `
 		INSERT INTO matches (player1_id, player2_id, winner_id, is_draw, game_state)
 		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
 	`
 	
 	// Convert game state to JSON
@@ -789,24 +1101,90 @@ func (m *TicTacToeMatch) recordMatchResult(ctx context.Context, s *TicTacToeStat
 		return
 	}
 	
-	// Execute query
-	_, err = m.db.ExecContext(ctx, query, player1ID, player2ID, winnerID, s.Winner == 3, gameStateJSON)
+	// Record the match and rate both players together so neither is rated
+	// without the other
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
+		m.logger.Error("Error starting match result transaction: %v", err)
+		return
+	}
+	defer tx.Rollback()
+	
+	var matchID string
+	if err := tx.QueryRowContext(ctx, query, player1ID, player2ID, winnerID, s.SeriesWinner == "", gameStateJSON).Scan(&matchID); err != nil {
 		m.logger.Error("Error recording match result: %v", err)
+		return
 	}
+	var rated []ratedPlayer
+	switch {
+	case stoppedFromOutside(reason):
+	case s.Ranked:
+		if rated, err = rateMatch(ctx, tx, matchID, player1ID, player2ID, s.SeriesWinner); err != nil {
+			m.logger.Error("Error rating match %s: %v", matchID, err)
+			return
+		}
+	default:
+		if err := countMatch(ctx, tx, matchID, player1ID, player2ID, s.SeriesWinner); err != nil {
+			m.logger.Error("Error updating stats for match %s: %v", matchID, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		m.logger.Error("Error committing match result: %v", err)
+		return
+	}
+	
+	// Leaderboards are kept by Nakama outside our transaction
+	writeLeaderboards(ctx, m.logger, m.nk, rated)
 }
 
-// Helper functions
-func min(a, b int) int {
-	if a < b {
-		return a
+// recordBotMatchResult records a series against the bot along with the
+// player's per-difficulty bot stats, which stay off the PvP leaderboard.
+// Series stopped from outside are recorded without touching the stats.
+func (m *TicTacToeMatch) recordBotMatchResult(ctx context.Context, s *TicTacToeState, reason string) {
+	var humanID string
+	for playerID := range s.Players {
+		if playerID != "bot" {
+			humanID = playerID
+		}
+	}
+
+	var winnerID interface{}
+	if s.SeriesWinner != "" && s.SeriesWinner != "bot" {
+		winnerID = s.SeriesWinner
+	}
+
+	gameStateJSON, err := json.Marshal(s)
+	if err != nil {
+		m.logger.Error("Error marshaling game state: %v", err)
+		return
 	}
-	return b
-}
 
-func max(a, b int) int {
-	if a > b {
-		return a
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		m.logger.Error("Error starting match result transaction: %v", err)
+		return
 	}
-	return b
-}
\ No newline at end of file
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO matches (player1_id, player2_id, winner_id, is_draw, bot_id, bot_difficulty, bot_won, game_state)
+		VALUES ($1, NULL, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`
+	var matchID string
+	err = tx.QueryRowContext(ctx, query, humanID, winnerID, s.SeriesWinner == "", s.BotStrategy, s.BotDifficulty, s.SeriesWinner == "bot", gameStateJSON).Scan(&matchID)
+	if err != nil {
+		m.logger.Error("Error recording bot match result: %v", err)
+		return
+	}
+	if !stoppedFromOutside(reason) {
+		if err := updateBotStats(ctx, tx, humanID, s.BotDifficulty, matchID, s.SeriesWinner == humanID, s.SeriesWinner == ""); err != nil {
+			m.logger.Error("Error updating bot stats: %v", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		m.logger.Error("Error committing bot match result: %v", err)
+	}
+}